@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/deck/branchtale/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var planPath string
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Execute a plan written with --plan-out",
+	Long:  "Apply creates the branch, pushes it and opens the pull request exactly as described in a plan file, without generating any content.",
+	Args:  cobra.NoArgs,
+	RunE:  runApply,
+}
+
+func init() {
+	applyCmd.Flags().StringVar(&planPath, "plan", "", "Path to the plan file")
+	applyCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what the plan would do without doing it")
+	applyCmd.Flags().StringVarP(&output, "output", "o", config.OutputText, "Output format ('text' or 'json')")
+	applyCmd.MarkFlagRequired("plan")
+	rootCmd.AddCommand(applyCmd)
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	service, err := newService(cfg)
+	if err != nil {
+		return err
+	}
+	result, err := service.Apply(cmd.Context(), planPath)
+	return report(cfg, result, err)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/deck/branchtale/internal/config"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var secretStore string
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage stored credentials",
+	Long:  "Store GitHub, YandexGPT and OpenAI credentials in an encrypted file or the git credential helper instead of environment variables. Environment variables still take precedence when set.",
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:       "login [github|yandex|openai]",
+	Short:     "Store credentials",
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"github", "yandex", "openai"},
+	RunE:      runAuthLogin,
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:       "logout [github|yandex|openai]",
+	Short:     "Remove stored credentials",
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"github", "yandex", "openai"},
+	RunE:      runAuthLogout,
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show where each credential comes from",
+	Args:  cobra.NoArgs,
+	RunE:  runAuthStatus,
+}
+
+func init() {
+	authCmd.PersistentFlags().StringVar(&secretStore, "store", os.Getenv("BRANCHTALE_SECRET_STORE"), "Secret store backend ('file' or 'git')")
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
+
+func selectedSecrets(args []string) ([]config.Secret, error) {
+	if len(args) == 0 {
+		return config.Secrets, nil
+	}
+	secret, err := config.LookupSecret(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []config.Secret{secret}, nil
+}
+
+func runAuthLogin(cmd *cobra.Command, args []string) error {
+	store, err := config.NewSecretStore(secretStore)
+	if err != nil {
+		return err
+	}
+	secrets, err := selectedSecrets(args)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for _, secret := range secrets {
+		fmt.Printf("%s (leave empty to skip): ", color.CyanString(secret.Description))
+		value, err := readSecret(reader)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		if err := store.Set(secret.Key, value); err != nil {
+			return fmt.Errorf("failed to store %s: %w", secret.Description, err)
+		}
+		color.Green("✓ %s saved to %s store", secret.Description, store.Name())
+	}
+	return nil
+}
+
+func runAuthLogout(cmd *cobra.Command, args []string) error {
+	store, err := config.NewSecretStore(secretStore)
+	if err != nil {
+		return err
+	}
+	secrets, err := selectedSecrets(args)
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		err := store.Delete(secret.Key)
+		if errors.Is(err, config.ErrSecretNotFound) {
+			fmt.Printf("%s is not stored\n", secret.Description)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", secret.Description, err)
+		}
+		color.Green("✓ %s removed from %s store", secret.Description, store.Name())
+	}
+	return nil
+}
+
+func runAuthStatus(cmd *cobra.Command, args []string) error {
+	store, err := config.NewSecretStore(secretStore)
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range config.Secrets {
+		if value := os.Getenv(secret.EnvVar); value != "" {
+			fmt.Printf("%s: %s from %s environment variable\n", secret.Description, color.GreenString(maskSecret(value)), secret.EnvVar)
+			continue
+		}
+		value, err := store.Get(secret.Key)
+		switch {
+		case errors.Is(err, config.ErrSecretNotFound):
+			fmt.Printf("%s: %s\n", secret.Description, color.YellowString("not configured"))
+		case err != nil:
+			fmt.Printf("%s: %s\n", secret.Description, color.RedString(err.Error()))
+		default:
+			fmt.Printf("%s: %s from %s store\n", secret.Description, color.GreenString(maskSecret(value)), store.Name())
+		}
+	}
+	return nil
+}
+
+func readSecret(reader *bufio.Reader) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		return strings.TrimSpace(string(value)), nil
+	}
+
+	value, err := reader.ReadString('\n')
+	if err != nil && value == "" {
+		return "", nil
+	}
+	return strings.TrimSpace(value), nil
+}
+
+func maskSecret(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:4] + "…" + value[len(value)-4:]
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/deck/branchtale/internal/cache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the response cache",
+	Long:  "Generated content is cached per backend, model, prompt template and diff, so rerunning branchtale on the same changes does not repeat the requests. Use --no-cache to bypass it for one run.",
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cached response",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheClear,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	dir, err := cache.Dir()
+	if err != nil {
+		return err
+	}
+	removed, err := cache.NewStore(dir, 0, 0).Clear()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s cached response(s) from %s\n", color.GreenString("%d", removed), dir)
+	return nil
+}
@@ -2,20 +2,47 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
 
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/cache"
 	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/git"
 	"github.com/deck/branchtale/internal/pr"
+	"github.com/deck/branchtale/internal/tracker"
+	"github.com/deck/branchtale/internal/usage"
+	"github.com/deck/branchtale/internal/vcs"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"golang.org/x/term"
 )
 
 var (
 	branchPrefix      string
+	branchTemplate    string
+	titleTemplate     string
+	titleStyle        string
+	language          string
+	ticketPattern     string
+	issueTracker      string
+	fetchIssue        bool
 	verbose           bool
 	dryRun            bool
+	interactive       bool
+	output            string
+	planOut           string
+	rollback          bool
+	resetBase         bool
+	noCache           bool
 	contentGeneration string
+
+	// usageMeter counts the tokens of the current run, if it uses a model.
+	usageMeter *usage.Meter
 )
 
 var rootCmd = &cobra.Command{
@@ -35,37 +62,361 @@ func main() {
 
 func init() {
 	rootCmd.Flags().StringVarP(&branchPrefix, "prefix", "p", "", "Branch name prefix (e.g., 'feature/xyz-123-')")
+	rootCmd.Flags().StringVar(&branchTemplate, "branch-template", "", "Branch name template with {type}, {ticket} and {slug} placeholders (e.g., '{type}/{ticket}-{slug}')")
+	rootCmd.Flags().StringVar(&titleTemplate, "title-template", "", "Pull request title template with {ticket} and {title} placeholders (e.g., '{ticket}: {title}')")
+	rootCmd.Flags().StringVar(&titleStyle, "title-style", "", "Pull request title style ('plain' or 'conventional' for 'type(scope): subject')")
+	rootCmd.Flags().StringVarP(&language, "language", "l", "", "Language of generated titles and descriptions ('en' or 'ru'; defaults to git config branchtale.language)")
+	rootCmd.Flags().StringVar(&ticketPattern, "ticket-pattern", "", "Regular expression for ticket keys in branch names, the prefix and commit messages")
+	rootCmd.Flags().StringVar(&issueTracker, "tracker", "", "Issue tracker for ticket links ('github' or 'jira')")
+	rootCmd.Flags().BoolVar(&fetchIssue, "fetch-issue", false, "Fetch the ticket's issue from the tracker and use it as context for generation")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
-	rootCmd.Flags().StringVarP(&contentGeneration, "content-generation", "c", "local", "Content generation mode (e.g., 'local', 'yandex')")
+	rootCmd.Flags().StringVarP(&contentGeneration, "content-generation", "c", "local", "Content generation backends, tried in order (e.g., 'local', 'yandex', 'yandex,openai,local')")
+	rootCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Review and edit generated content and confirm each step before it runs")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Enable dry run mode (no changes will be pushed or PR created)")
+	rootCmd.Flags().StringVarP(&output, "output", "o", config.OutputText, "Output format ('text' or 'json')")
+	rootCmd.Flags().BoolVar(&resetBase, "reset-base", false, "After pushing a branch created from main, move local main back to origin/main (asked by default in interactive mode)")
+	rootCmd.Flags().BoolVar(&rollback, "rollback", false, "Undo an unfinished run: return to the original branch and delete the branches it created")
+	rootCmd.Flags().StringVar(&planOut, "plan-out", "", "Write the computed plan to this file (can be executed later with 'branchtale apply')")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not reuse or store generated content in the response cache")
 }
 
 func runRoot(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	service, err := newService(cfg)
+	if err != nil {
+		return err
+	}
+
+	var result *pr.Result
+	if rollback {
+		result, err = service.Rollback(ctx)
+	} else {
+		result, err = service.Run(ctx)
+	}
+	return report(cfg, result, err)
+}
+
+func newService(cfg *config.Config) (*pr.Service, error) {
+	repoPath, err := repositoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	gitRepo, err := git.NewRepository(repoPath, cfg.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize git repository: %w", err)
+	}
+
+	if cfg.Language == "" {
+		repoLanguage, err := gitRepo.ConfigValue("branchtale", "language")
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.SetLanguage(repoLanguage); err != nil {
+			return nil, fmt.Errorf("invalid git config branchtale.language: %w", err)
+		}
+	}
+
+	gitDir, err := git.GitDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	generator, err := newGenerator(cfg, repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	vcsProvider := vcs.NewGitHubProviderWithTokenSource(githubTokenSource{cfg: cfg})
+
+	service := pr.NewService(cfg, gitRepo, generator, vcsProvider, pr.NewFileStateStore(gitDir))
+	switch cfg.Tracker {
+	case config.TrackerGitHub:
+		remoteURL, err := gitRepo.GetRemoteUrl(context.Background(), "origin")
+		if err != nil {
+			return nil, err
+		}
+		owner, repo, err := vcs.ParseGitHubURL(remoteURL)
+		if err != nil {
+			return nil, err
+		}
+		service.SetIssueTracker(tracker.NewGitHubIssues(githubTokenSource{cfg: cfg}, owner, repo))
+	case config.TrackerJira:
+		service.SetIssueTracker(tracker.NewJira(cfg.JiraURL, cfg.JiraUser, cfg.JiraToken))
+	}
+
+	if cfg.Verbose {
+		fmt.Fprintln(color.Output, "Services initialized successfully")
+	}
+
+	return service, nil
+}
+
+// newGenerator builds the configured backends, each with its own cache, and
+// chains them when there are several.
+func newGenerator(cfg *config.Config, repoPath string) (pr.ContentGenerator, error) {
+	var prompts *ai.Prompts
+	if cfg.UseAI {
+		var err error
+		if prompts, err = loadPrompts(repoPath); err != nil {
+			return nil, err
+		}
+		prices := maps.Clone(usage.DefaultPrices)
+		maps.Copy(prices, cfg.Prices)
+		usageMeter = usage.NewMeter(cfg.ContentGeneration, prices)
+	}
+
+	var store *cache.Store
+	if !cfg.NoCache {
+		dir, err := cache.Dir()
+		if err != nil {
+			return nil, err
+		}
+		store = cache.NewStore(dir, cfg.CacheTTL, cfg.CacheMaxSize)
+	}
+
+	chain := pr.NewFallbackGenerator(color.Output, cfg.FallbackTimeout)
+	for _, backend := range cfg.Generators {
+		generator, err := newBackend(cfg, backend, prompts)
+		if err != nil {
+			return nil, err
+		}
+		// Local answers are free and instant, so only remote ones are cached.
+		if store != nil && backend != config.GeneratorLocal {
+			generator = cache.NewGenerator(backend, generator, store)
+		}
+		if len(cfg.Generators) == 1 {
+			return generator, nil
+		}
+		chain.Add(backend, generator)
+	}
+	return chain, nil
+}
+
+func newBackend(cfg *config.Config, backend string, prompts *ai.Prompts) (pr.ContentGenerator, error) {
+	switch backend {
+	case config.GeneratorYandex:
+		yandex := ai.NewYandexGPT(cfg.YandexGPTAPIKey, cfg.YandexFolderID)
+		yandex.SetPrompts(prompts)
+		configureYandex(yandex, cfg)
+		yandex.SetUsageRecorder(usageMeter.Backend(backend))
+		switch {
+		case cfg.YandexIAMToken != "":
+			yandex.SetAuth(ai.IAMTokenAuth(cfg.YandexIAMToken))
+		case cfg.YandexKeyFile != "":
+			key, err := ai.LoadServiceAccountKey(cfg.YandexKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			auth, err := ai.NewServiceAccountAuth(key, cfg.YandexIAMEndpoint)
+			if err != nil {
+				return nil, err
+			}
+			yandex.SetAuth(auth)
+		}
+		return yandex, nil
+	case config.GeneratorOpenAI:
+		openai := ai.NewOpenAI(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL, cfg.OpenAIModel)
+		openai.SetPrompts(prompts)
+		openai.SetUsageRecorder(usageMeter.Backend(backend))
+		if cfg.OpenAIConcurrency > 0 {
+			openai.SetConcurrency(cfg.OpenAIConcurrency)
+		}
+		return openai, nil
+	default:
+		return ai.NewLocal(), nil
+	}
+}
+
+// configureYandex applies the configured endpoint and model settings: the
+// operation-specific ones win over those for every operation.
+func configureYandex(yandex *ai.YandexGPT, cfg *config.Config) {
+	if cfg.YandexEndpoint != "" {
+		yandex.Endpoint = cfg.YandexEndpoint
+	}
+	if cfg.YandexOperationEndpoint != "" {
+		yandex.OperationEndpoint = cfg.YandexOperationEndpoint
+	}
+	if cfg.YandexConcurrency > 0 {
+		yandex.SetConcurrency(cfg.YandexConcurrency)
+	}
+	kinds := map[string]ai.ContentKind{"title": ai.KindTitle, "description": ai.KindDescription, "branch": ai.KindBranchName, "content": ai.KindContent}
+	for _, operation := range config.ModelOperations {
+		options := yandex.Options(kinds[operation])
+		for _, settings := range []config.ModelSettings{cfg.YandexModel, cfg.YandexModels[operation]} {
+			if settings.Model != "" {
+				options.Model = settings.Model
+			}
+			if settings.Temperature != nil {
+				options.Temperature = *settings.Temperature
+			}
+			if settings.MaxTokens != 0 {
+				options.MaxTokens = settings.MaxTokens
+			}
+			if settings.Mode != "" {
+				options.Mode = settings.Mode
+			}
+		}
+		yandex.SetOptions(kinds[operation], options)
+	}
+}
+
+func repositoryPath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	repoPath, err := git.FindRepository(cwd)
+	if err != nil {
+		return "", fmt.Errorf("failed to find git repository: %w", err)
+	}
+	return repoPath, nil
+}
+
+// loadPrompts reads prompt overrides from the config directory and from
+// .branchtale/prompts in the repository, which wins.
+func loadPrompts(repoPath string) (*ai.Prompts, error) {
+	configDir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return ai.LoadPrompts(filepath.Join(configDir, "prompts"), filepath.Join(repoPath, ".branchtale", "prompts"))
+}
+
+// githubTokenSource defers the token lookup until the first GitHub API call.
+type githubTokenSource struct {
+	cfg *config.Config
+}
+
+func (s githubTokenSource) Token() (*oauth2.Token, error) {
+	if err := s.cfg.RequireGitHubToken(); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: s.cfg.GitHubToken}, nil
+}
+
+func loadConfig() (*config.Config, error) {
 	cfg, err := config.LoadEnvs()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	cfg.BranchPrefix = branchPrefix
+	if branchTemplate != "" {
+		cfg.BranchTemplate = branchTemplate
+	}
+	if titleTemplate != "" {
+		cfg.TitleTemplate = titleTemplate
+	}
+	if titleStyle != "" {
+		cfg.TitleStyle = titleStyle
+	}
+	if language != "" {
+		cfg.Language = language
+	}
+	if ticketPattern != "" {
+		cfg.TicketPattern = ticketPattern
+	}
+	if issueTracker != "" {
+		cfg.Tracker = issueTracker
+	}
+	cfg.FetchIssues = cfg.FetchIssues || fetchIssue
 	cfg.Verbose = verbose
 	cfg.ContentGeneration = contentGeneration
 	cfg.DryRun = dryRun
+	cfg.Interactive = interactive
+	cfg.Output = output
+	cfg.PlanOut = planOut
+	cfg.ResetBase = resetBase
+	cfg.NoCache = cfg.NoCache || noCache
+
+	if cfg.Output == config.OutputJSON {
+		color.Output = os.Stderr
+	}
+
+	if cfg.Interactive && !term.IsTerminal(int(os.Stdin.Fd())) {
+		if cfg.Verbose {
+			color.Yellow("stdin is not a terminal, interactive prompts are disabled")
+		}
+		cfg.Interactive = false
+	}
 
 	if err := cfg.Finalize(); err != nil {
-		return fmt.Errorf("failed to finalize configuration: %w", err)
+		return nil, fmt.Errorf("failed to finalize configuration: %w", err)
+	}
+	for _, skipped := range cfg.SkippedGenerators {
+		fmt.Fprintln(color.Output, color.YellowString("Skipping content generation backend %s", skipped))
 	}
 
 	if cfg.Verbose {
 		color.Green("✓ Configuration loaded successfully")
 	}
 
-	service := pr.NewService(cfg)
-	if err := service.Run(ctx); err != nil {
+	return cfg, nil
+}
+
+func report(cfg *config.Config, result *pr.Result, err error) error {
+	reportUsage(cfg, result)
+
+	if cfg.Output == config.OutputJSON && result != nil {
+		if err != nil {
+			result.Status = pr.StatusFailed
+			result.Error = err.Error()
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(result); encodeErr != nil {
+			return fmt.Errorf("failed to encode result: %w", encodeErr)
+		}
+	}
+
+	if err != nil {
 		color.New(color.FgRed).Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	return nil
 }
+
+// reportUsage shows the tokens spent in this run and appends them to the
+// usage log.
+func reportUsage(cfg *config.Config, result *pr.Result) {
+	if usageMeter == nil {
+		return
+	}
+	records := usageMeter.Records()
+	if len(records) == 0 {
+		return
+	}
+	summary := usage.Summarize(records)
+	if result != nil {
+		result.Usage = summary
+	}
+	fmt.Fprintf(color.Output, "Usage: %s\n", summary)
+
+	path, err := usageLogPath(cfg)
+	if err == nil {
+		err = usage.AppendLog(path, records)
+	}
+	if err != nil {
+		fmt.Fprintln(color.Output, color.YellowString("Could not update the usage log: %v", err))
+	}
+}
+
+func usageLogPath(cfg *config.Config) (string, error) {
+	if cfg.UsageLog != "" {
+		return cfg.UsageLog, nil
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "usage.jsonl"), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var promptsCmd = &cobra.Command{
+	Use:   "prompts",
+	Short: "Inspect the prompt templates",
+	Long:  "Prompts are text/template files. The embedded defaults can be overridden per user in <config dir>/prompts/<name>.tmpl and per repository in .branchtale/prompts/<name>.tmpl.",
+}
+
+var promptsShowCmd = &cobra.Command{
+	Use:       "show [title|description|branch|content|context]",
+	Short:     "Show where each prompt comes from, or the template of one prompt",
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: ai.PromptNames,
+	RunE:      runPromptsShow,
+}
+
+var promptsRenderCmd = &cobra.Command{
+	Use:       "render title|description|branch|content",
+	Short:     "Render a prompt for the current branch as it would be sent",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"title", "description", "branch", "content"},
+	RunE:      runPromptsRender,
+}
+
+func init() {
+	promptsRenderCmd.Flags().StringVarP(&language, "language", "l", "", "Language of generated titles and descriptions ('en' or 'ru')")
+	promptsRenderCmd.Flags().StringVarP(&branchPrefix, "prefix", "p", "", "Branch name prefix (e.g., 'feature/xyz-123-')")
+	promptsRenderCmd.Flags().StringVar(&titleStyle, "title-style", "", "Pull request title style ('plain' or 'conventional')")
+	promptsRenderCmd.Flags().StringVar(&ticketPattern, "ticket-pattern", "", "Regular expression for ticket keys")
+	promptsRenderCmd.Flags().StringVar(&issueTracker, "tracker", "", "Issue tracker for ticket links ('github' or 'jira')")
+	promptsRenderCmd.Flags().BoolVar(&fetchIssue, "fetch-issue", false, "Fetch the ticket's issue from the tracker")
+	promptsCmd.AddCommand(promptsShowCmd, promptsRenderCmd)
+	rootCmd.AddCommand(promptsCmd)
+}
+
+func runPromptsShow(cmd *cobra.Command, args []string) error {
+	repoPath, err := repositoryPath()
+	if err != nil {
+		return err
+	}
+	prompts, err := loadPrompts(repoPath)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		for _, name := range ai.PromptNames {
+			_, origin, _ := prompts.Source(name)
+			fmt.Printf("%-12s %s\n", color.GreenString(name), origin)
+		}
+		return nil
+	}
+
+	source, origin, err := prompts.Source(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(color.BlueString("# %s", origin))
+	fmt.Print(source)
+	return nil
+}
+
+func runPromptsRender(cmd *cobra.Command, args []string) error {
+	var kind ai.ContentKind
+	switch args[0] {
+	case "title":
+		kind = ai.KindTitle
+	case "description":
+		kind = ai.KindDescription
+	case "branch":
+		kind = ai.KindBranchName
+	case "content":
+		kind = ai.KindContent
+	default:
+		return fmt.Errorf("unknown prompt %q (expected 'title', 'description', 'branch' or 'content')", args[0])
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	repoPath, err := repositoryPath()
+	if err != nil {
+		return err
+	}
+	prompts, err := loadPrompts(repoPath)
+	if err != nil {
+		return err
+	}
+	service, err := newService(cfg)
+	if err != nil {
+		return err
+	}
+
+	input, err := service.ContentInput(cmd.Context())
+	if err != nil {
+		return err
+	}
+	prompt, err := prompts.Render(kind, input)
+	if err != nil {
+		return err
+	}
+	fmt.Println(prompt)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/deck/branchtale/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var splitYes bool
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split local commits on main into several pull requests",
+	Long:  "Split groups the local commits on main by the directories they touch, shows the proposed grouping and, once confirmed, creates a branch per group by cherry-picking its commits onto origin/main and opens a pull request for each branch.",
+	Args:  cobra.NoArgs,
+	RunE:  runSplit,
+}
+
+func init() {
+	splitCmd.Flags().StringVarP(&language, "language", "l", "", "Language of generated titles and descriptions ('en' or 'ru')")
+	splitCmd.Flags().StringVarP(&branchPrefix, "prefix", "p", "", "Branch name prefix (e.g., 'feature/xyz-123-')")
+	splitCmd.Flags().StringVar(&branchTemplate, "branch-template", "", "Branch name template with {type}, {ticket} and {slug} placeholders (e.g., '{type}/{ticket}-{slug}')")
+	splitCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	splitCmd.Flags().StringVarP(&contentGeneration, "content-generation", "c", "local", "Content generation backends, tried in order (e.g., 'local', 'yandex', 'yandex,openai,local')")
+	splitCmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not reuse or store generated content in the response cache")
+	splitCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the proposed grouping without creating anything")
+	splitCmd.Flags().StringVarP(&output, "output", "o", config.OutputText, "Output format ('text' or 'json')")
+	splitCmd.Flags().BoolVarP(&splitYes, "yes", "y", false, "Accept the proposed grouping without asking")
+	rootCmd.AddCommand(splitCmd)
+}
+
+func runSplit(cmd *cobra.Command, args []string) error {
+	interactive = !splitYes
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	service, err := newService(cfg)
+	if err != nil {
+		return err
+	}
+	result, err := service.Split(cmd.Context(), splitYes)
+	return report(cfg, result, err)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/deck/branchtale/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var stackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "Create or update pull requests for a stack of branches",
+	Long:  "Stack walks down from the current branch through the local branches it is based on, pushes them, opens a pull request for each one against the branch below it and links the pull requests to each other. Once the lowest pull request is merged, the rest of the stack is rebased onto the main branch and retargeted.",
+	Args:  cobra.NoArgs,
+	RunE:  runStack,
+}
+
+func init() {
+	stackCmd.Flags().StringVarP(&language, "language", "l", "", "Language of generated titles and descriptions ('en' or 'ru')")
+	stackCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	stackCmd.Flags().StringVarP(&contentGeneration, "content-generation", "c", "local", "Content generation backends, tried in order (e.g., 'local', 'yandex', 'yandex,openai,local')")
+	stackCmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not reuse or store generated content in the response cache")
+	stackCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without doing it")
+	stackCmd.Flags().StringVarP(&output, "output", "o", config.OutputText, "Output format ('text' or 'json')")
+	rootCmd.AddCommand(stackCmd)
+}
+
+func runStack(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	service, err := newService(cfg)
+	if err != nil {
+		return err
+	}
+	result, err := service.Stack(cmd.Context())
+	return report(cfg, result, err)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/usage"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var usageMonth string
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show tokens and estimated cost per month",
+	Long:  "Every run that calls a model appends its token counts and estimated cost to a usage log in the config directory (or BRANCHTALE_USAGE_LOG). This command sums the log up per month and model.",
+	Args:  cobra.NoArgs,
+	RunE:  runUsage,
+}
+
+func init() {
+	usageCmd.Flags().StringVar(&usageMonth, "month", "", "Only show this month (YYYY-MM)")
+	rootCmd.AddCommand(usageCmd)
+}
+
+func runUsage(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadEnvs()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	path, err := usageLogPath(cfg)
+	if err != nil {
+		return err
+	}
+	records, err := usage.ReadLog(path)
+	if err != nil {
+		return err
+	}
+
+	shown := 0
+	for _, period := range usage.Monthly(records) {
+		if usageMonth != "" && period.Month != usageMonth {
+			continue
+		}
+		shown++
+		fmt.Printf("%s  %s\n", color.GreenString(period.Month), period.Total)
+		for _, model := range slices.Sorted(maps.Keys(period.Models)) {
+			fmt.Printf("  %-22s %s\n", model, period.Models[model])
+		}
+	}
+	if shown == 0 {
+		fmt.Printf("No usage recorded in %s\n", path)
+	}
+	return nil
+}
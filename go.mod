@@ -8,6 +8,8 @@ require (
 	github.com/google/go-github/v74 v74.0.0
 	github.com/spf13/cobra v1.10.1
 	golang.org/x/oauth2 v0.31.0
+	golang.org/x/sync v0.17.0
+	golang.org/x/term v0.35.0
 )
 
 require (
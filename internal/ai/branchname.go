@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"strings"
+	"unicode"
+)
+
+var cyrillicTranslit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// Transliterate returns the Latin spelling of a Cyrillic letter in lower
+// case, and false for any other rune.
+func Transliterate(r rune) (string, bool) {
+	latin, ok := cyrillicTranslit[unicode.ToLower(r)]
+	return latin, ok
+}
+
+// SanitizeBranchSlug turns free text such as model output into a lowercase
+// kebab-case ASCII slug of at most maxLength characters, cut at a word
+// boundary. Cyrillic is transliterated.
+func SanitizeBranchSlug(text string, maxLength int) string {
+	text = strings.TrimSpace(text)
+	if line, _, ok := strings.Cut(text, "\n"); ok {
+		text = line
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if latin, ok := cyrillicTranslit[r]; ok {
+			b.WriteString(latin)
+			dash = false
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+
+	if len(slug) > maxLength {
+		slug = slug[:maxLength]
+		if i := strings.LastIndex(slug, "-"); i > maxLength/2 {
+			slug = slug[:i]
+		}
+		slug = strings.Trim(slug, "-")
+	}
+	return slug
+}
@@ -0,0 +1,26 @@
+package ai
+
+import "testing"
+
+func TestSanitizeBranchSlug(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"add-response-cache", "add-response-cache"},
+		{"\"Add Response Cache\"\n", "add-response-cache"},
+		{"`fix: handle  nil`", "fix-handle-nil"},
+		{"Branch name: add_cache\nExplanation: ...", "branch-name-add-cache"},
+		{"Кэш", "kesh"},
+		{"Добавить кэш ответов", "dobavit-kesh-otvetov"},
+		{"Щука и ёж", "shchuka-i-ezh"},
+		{"日本", ""},
+		{"add a very long branch name that keeps going well past the limit of the slug", "add-a-very-long-branch-name-that-keeps-going-well"},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeBranchSlug(tt.input, 50); got != tt.want {
+			t.Errorf("SanitizeBranchSlug(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
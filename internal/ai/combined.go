@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMalformedContent is returned when a combined answer is not the JSON
+// object that was asked for. Callers can fall back to separate requests.
+var ErrMalformedContent = errors.New("malformed content")
+
+// Content is everything generated for a pull request in one request.
+// BranchName is empty when Input.Branch is set.
+type Content struct {
+	BranchName  string   `json:"branch_name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels"`
+}
+
+// ParseContent reads the JSON object in a model's answer, tolerating code
+// fences and text around it. The branch name is required unless the input
+// already has a branch.
+func ParseContent(text string, input *Input) (*Content, error) {
+	start := strings.Index(text, "{")
+	if start < 0 {
+		return nil, fmt.Errorf("%w: no JSON object in %q", ErrMalformedContent, truncateText(text, 200))
+	}
+
+	var content Content
+	if err := json.NewDecoder(strings.NewReader(text[start:])).Decode(&content); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedContent, err)
+	}
+	content.BranchName = strings.TrimSpace(content.BranchName)
+	content.Title = strings.TrimSpace(content.Title)
+	content.Description = strings.TrimSpace(content.Description)
+
+	var missing []string
+	if content.BranchName == "" && input.Branch == "" {
+		missing = append(missing, "branch_name")
+	}
+	if content.Title == "" {
+		missing = append(missing, "title")
+	}
+	if content.Description == "" {
+		missing = append(missing, "description")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing %s", ErrMalformedContent, strings.Join(missing, ", "))
+	}
+	if input.Branch != "" {
+		content.BranchName = ""
+	}
+
+	labels, seen := []string{}, map[string]bool{}
+	for _, label := range content.Labels {
+		label = strings.TrimSpace(label)
+		if label != "" && !seen[strings.ToLower(label)] {
+			seen[strings.ToLower(label)] = true
+			labels = append(labels, label)
+		}
+	}
+	content.Labels = labels
+	return &content, nil
+}
@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		input   *Input
+		want    Content
+		wantErr string
+	}{
+		{
+			name:  "plain JSON",
+			text:  `{"branch_name": "add-cache", "title": "Add cache", "description": "Adds a cache.", "labels": ["enhancement"]}`,
+			input: &Input{},
+			want:  Content{BranchName: "add-cache", Title: "Add cache", Description: "Adds a cache.", Labels: []string{"enhancement"}},
+		},
+		{
+			name:  "code fence and surrounding text",
+			text:  "Here it is:\n```json\n{\"branch_name\": \"add-cache\", \"title\": \" Add cache \", \"description\": \"Uses {braces}.\"}\n```\nHope this helps {:}",
+			input: &Input{},
+			want:  Content{BranchName: "add-cache", Title: "Add cache", Description: "Uses {braces}.", Labels: []string{}},
+		},
+		{
+			name:  "labels deduplicated",
+			text:  `{"branch_name": "x", "title": "T", "description": "D", "labels": ["bug", " Bug", "", "tests"]}`,
+			input: &Input{},
+			want:  Content{BranchName: "x", Title: "T", Description: "D", Labels: []string{"bug", "tests"}},
+		},
+		{
+			name:  "branch not needed on an existing branch",
+			text:  `{"branch_name": "other", "title": "T", "description": "D"}`,
+			input: &Input{Branch: "add-cache"},
+			want:  Content{Title: "T", Description: "D", Labels: []string{}},
+		},
+		{
+			name:    "no JSON",
+			text:    "Add cache",
+			input:   &Input{},
+			wantErr: "no JSON object",
+		},
+		{
+			name:    "truncated JSON",
+			text:    `{"branch_name": "add-cache", "title": "Add cache", "descr`,
+			input:   &Input{},
+			wantErr: "unexpected EOF",
+		},
+		{
+			name:    "missing fields",
+			text:    `{"title": "Add cache"}`,
+			input:   &Input{},
+			wantErr: "missing branch_name, description",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := ParseContent(tt.text, tt.input)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrMalformedContent) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected malformed content error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if content.BranchName != tt.want.BranchName || content.Title != tt.want.Title || content.Description != tt.want.Description ||
+				strings.Join(content.Labels, ",") != strings.Join(tt.want.Labels, ",") {
+				t.Errorf("Expected %+v, got %+v", tt.want, *content)
+			}
+		})
+	}
+}
+
+func TestYandexGPT_GenerateContent(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req YandexGPTRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[0].Text
+		if req.CompletionOptions.MaxTokens != 1500 {
+			t.Errorf("Expected the content token limit, got %d", req.CompletionOptions.MaxTokens)
+		}
+		text := `{"title": "Add cache", "description": "Adds a cache.", "labels": ["enhancement"]}`
+		json.NewEncoder(w).Encode(YandexGPTResponse{Result: Result{Alternatives: []Alternative{{Message: Message{Text: text}}}}})
+	}))
+	defer server.Close()
+
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL
+
+	content, err := yandex.GenerateContent(context.Background(), &Input{Diff: "diff", Branch: "add-cache"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content.Title != "Add cache" || content.Labels[0] != "enhancement" {
+		t.Errorf("Unexpected content: %+v", content)
+	}
+	if strings.Contains(prompt, "branch_name") || !strings.Contains(prompt, `"labels"`) {
+		t.Errorf("Expected no branch name to be asked for on an existing branch, got %s", prompt)
+	}
+
+	if _, err := yandex.GenerateContent(context.Background(), &Input{Diff: "diff"}); !errors.Is(err, ErrMalformedContent) {
+		t.Errorf("Expected a missing branch name to be malformed, got %v", err)
+	}
+	if !strings.Contains(prompt, "branch_name") {
+		t.Errorf("Expected the branch name to be asked for, got %s", prompt)
+	}
+}
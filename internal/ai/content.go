@@ -0,0 +1,59 @@
+package ai
+
+type ContentKind string
+
+const (
+	KindTitle       ContentKind = "title"
+	KindDescription ContentKind = "description"
+	KindBranchName  ContentKind = "branch name"
+	// KindContent is the branch name, title, description and labels
+	// generated together as one JSON object.
+	KindContent ContentKind = "content"
+)
+
+type Revision struct {
+	Output   string
+	Feedback string
+}
+
+// Input is what content is generated from: the diff, the changed files, the
+// commit subjects (oldest first), the branch when it already exists and,
+// when one was found, the ticket the change belongs to. Conventional is set
+// when titles follow Conventional Commits and holds the inferred type and
+// scope. It is also the data of the prompt templates.
+type Input struct {
+	Diff         string
+	Files        []string
+	Commits      []string
+	Branch       string
+	Ticket       string
+	Issue        *Issue
+	Language     string
+	Conventional *Conventional
+}
+
+type Conventional struct {
+	Type  string
+	Scope string
+}
+
+type Issue struct {
+	Key   string
+	Title string
+	Body  string
+	URL   string
+}
+
+// Usage is the token count of one completion.
+type Usage struct {
+	Kind         ContentKind
+	Model        string
+	Mode         string
+	InputTokens  int
+	OutputTokens int
+	Status       string
+}
+
+type UsageRecorder interface {
+	RecordUsage(usage Usage)
+}
@@ -2,22 +2,73 @@ package ai
 
 import (
 	"context"
+	"regexp"
+	"strings"
 )
 
+// commitHeader matches the Conventional Commits header of a commit subject.
+var commitHeader = regexp.MustCompile(`^[A-Za-z]+(\([^)]*\))?!?:\s*`)
+
 type Local struct{}
 
 func NewLocal() *Local {
 	return &Local{}
 }
 
-func (l *Local) GeneratePRTitle(ctx context.Context, diff string) (string, error) {
-	return "", nil
+// GeneratePRTitle uses the title of the linked issue, if one was fetched, or
+// the first commit subject. For Conventional Commits titles the subject gets
+// the inferred type and scope.
+func (l *Local) GeneratePRTitle(ctx context.Context, input *Input) (string, error) {
+	if input.Issue != nil {
+		return input.Issue.Title, nil
+	}
+	if len(input.Commits) == 0 {
+		return "", nil
+	}
+	subject := strings.TrimSpace(input.Commits[0])
+	if input.Conventional == nil {
+		return subject, nil
+	}
+	header := input.Conventional.Type
+	if input.Conventional.Scope != "" {
+		header += "(" + input.Conventional.Scope + ")"
+	}
+	return header + ": " + commitHeader.ReplaceAllString(subject, ""), nil
 }
 
-func (l *Local) GeneratePRDescription(ctx context.Context, diff string) (string, error) {
+func (l *Local) GeneratePRDescription(ctx context.Context, input *Input) (string, error) {
 	return "", nil
 }
 
-func (l *Local) GenerateBranchName(ctx context.Context, diff string) (string, error) {
+func (l *Local) GenerateBranchName(ctx context.Context, input *Input) (string, error) {
+	if input.Issue != nil {
+		return input.Issue.Title, nil
+	}
 	return "", nil
 }
+
+// GenerateContent combines the other methods; Local suggests no labels.
+func (l *Local) GenerateContent(ctx context.Context, input *Input) (*Content, error) {
+	title, err := l.GeneratePRTitle(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	description, err := l.GeneratePRDescription(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	content := &Content{Title: title, Description: description}
+	if input.Branch == "" {
+		if content.BranchName, err = l.GenerateBranchName(ctx, input); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+func (l *Local) Refine(ctx context.Context, kind ContentKind, input *Input, history []Revision) (string, error) {
+	if len(history) == 0 {
+		return "", nil
+	}
+	return history[len(history)-1].Output, nil
+}
@@ -7,7 +7,7 @@ import (
 
 func TestLocal_GeneratePRTitle(t *testing.T) {
 	l := NewLocal()
-	result, err := l.GeneratePRTitle(context.Background(), "some diff")
+	result, err := l.GeneratePRTitle(context.Background(), &Input{Diff: "some diff"})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -16,9 +16,27 @@ func TestLocal_GeneratePRTitle(t *testing.T) {
 	}
 }
 
+func TestLocal_GeneratePRTitle_commitSubject(t *testing.T) {
+	l := NewLocal()
+	input := &Input{Diff: "some diff", Commits: []string{"Add cache", "Document cache"}}
+	result, err := l.GeneratePRTitle(context.Background(), input)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "Add cache" {
+		t.Errorf("expected first commit subject, got '%s'", result)
+	}
+
+	input.Commits = []string{"fix: add cache"}
+	input.Conventional = &Conventional{Type: "feat", Scope: "cache"}
+	if result, _ := l.GeneratePRTitle(context.Background(), input); result != "feat(cache): add cache" {
+		t.Errorf("expected conventional title, got '%s'", result)
+	}
+}
+
 func TestLocal_GeneratePRDescription(t *testing.T) {
 	l := NewLocal()
-	result, err := l.GeneratePRDescription(context.Background(), "some diff")
+	result, err := l.GeneratePRDescription(context.Background(), &Input{Diff: "some diff"})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -29,7 +47,7 @@ func TestLocal_GeneratePRDescription(t *testing.T) {
 
 func TestLocal_GenerateBranchName(t *testing.T) {
 	l := NewLocal()
-	result, err := l.GenerateBranchName(context.Background(), "some diff")
+	result, err := l.GenerateBranchName(context.Background(), &Input{Diff: "some diff"})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -37,3 +55,45 @@ func TestLocal_GenerateBranchName(t *testing.T) {
 		t.Errorf("expected empty string, got '%s'", result)
 	}
 }
+
+func TestLocal_Refine(t *testing.T) {
+	l := NewLocal()
+	history := []Revision{{Output: "Keep me", Feedback: "Change it"}}
+	result, err := l.Refine(context.Background(), KindTitle, &Input{Diff: "some diff"}, history)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "Keep me" {
+		t.Errorf("expected previous output, got '%s'", result)
+	}
+}
+
+func TestLocal_GeneratePRTitle_usesIssue(t *testing.T) {
+	l := NewLocal()
+	input := &Input{Diff: "some diff", Issue: &Issue{Key: "PROJ-1", Title: "Cache responses"}}
+	result, err := l.GeneratePRTitle(context.Background(), input)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "Cache responses" {
+		t.Errorf("expected issue title, got '%s'", result)
+	}
+}
+
+func TestLocal_GenerateContent(t *testing.T) {
+	local := NewLocal()
+	input := &Input{Commits: []string{"Add cache"}, Issue: &Issue{Key: "PROJ-1", Title: "Cache responses"}}
+
+	content, err := local.GenerateContent(context.Background(), input)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if content.BranchName != "Cache responses" || content.Title != "Cache responses" || content.Description != "" {
+		t.Errorf("unexpected content: %+v", content)
+	}
+
+	input.Branch = "add-cache"
+	if content, _ := local.GenerateContent(context.Background(), input); content.BranchName != "" {
+		t.Errorf("expected no branch name on an existing branch, got '%s'", content.BranchName)
+	}
+}
@@ -0,0 +1,231 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/deck/branchtale/internal/httpclient"
+)
+
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOpenAIModel   = "gpt-4o-mini"
+	// DefaultOpenAIConcurrency is how many requests run at the same time
+	// unless SetConcurrency says otherwise.
+	DefaultOpenAIConcurrency = 3
+)
+
+// openAIMaxTokens are the token limits per kind of content, the same as the
+// YandexGPT defaults.
+var openAIMaxTokens = map[ContentKind]int{
+	KindTitle:       200,
+	KindDescription: 1000,
+	KindBranchName:  100,
+	KindContent:     1500,
+}
+
+// OpenAI generates content with the chat completions API of OpenAI or of a
+// compatible server, such as a local Ollama or vLLM, at BaseURL.
+type OpenAI struct {
+	APIKey      string
+	BaseURL     string
+	Model       string
+	Temperature float64
+	client      *http.Client
+	slots       chan struct{}
+	usage       UsageRecorder
+	prompts     *Prompts
+}
+
+type OpenAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	Temperature float64         `json:"temperature"`
+	MaxTokens   int             `json:"max_tokens"`
+}
+
+type OpenAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIResponse struct {
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+type OpenAIChoice struct {
+	Message      OpenAIMessage `json:"message"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+func NewOpenAI(apiKey, baseURL, model string) *OpenAI {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+	return &OpenAI{
+		APIKey:      apiKey,
+		BaseURL:     baseURL,
+		Model:       model,
+		Temperature: 0.3,
+		client:      httpclient.New(httpclient.Options{}),
+		slots:       make(chan struct{}, DefaultOpenAIConcurrency),
+		prompts:     DefaultPrompts(),
+	}
+}
+
+// SetPrompts replaces the default prompt templates.
+func (o *OpenAI) SetPrompts(prompts *Prompts) {
+	o.prompts = prompts
+}
+
+// SetUsageRecorder receives the token usage of every completion.
+func (o *OpenAI) SetUsageRecorder(r UsageRecorder) {
+	o.usage = r
+}
+
+// SetConcurrency limits how many requests are in flight at the same time;
+// further ones wait for a free slot. n <= 0 removes the limit.
+func (o *OpenAI) SetConcurrency(n int) {
+	o.slots = nil
+	if n > 0 {
+		o.slots = make(chan struct{}, n)
+	}
+}
+
+// Fingerprint identifies what an answer for kind depends on besides the
+// input: the server, the model and the prompt templates.
+func (o *OpenAI) Fingerprint(kind ContentKind) string {
+	source, _, _ := o.prompts.Source(PromptName(kind))
+	partial, _, _ := o.prompts.Source("context")
+	sum := sha256.Sum256([]byte(source + partial))
+	return fmt.Sprintf("%s %s %g %d %x", o.BaseURL, o.Model, o.Temperature, openAIMaxTokens[kind], sum[:8])
+}
+
+func (o *OpenAI) GeneratePRTitle(ctx context.Context, input *Input) (string, error) {
+	return o.generate(ctx, KindTitle, input)
+}
+
+func (o *OpenAI) GeneratePRDescription(ctx context.Context, input *Input) (string, error) {
+	return o.generate(ctx, KindDescription, input)
+}
+
+func (o *OpenAI) GenerateBranchName(ctx context.Context, input *Input) (string, error) {
+	return o.generate(ctx, KindBranchName, input)
+}
+
+// GenerateContent asks for everything in one request. An answer that is not
+// the expected JSON object fails with ErrMalformedContent.
+func (o *OpenAI) GenerateContent(ctx context.Context, input *Input) (*Content, error) {
+	prompt, err := o.prompts.Render(KindContent, input)
+	if err != nil {
+		return nil, err
+	}
+	return generateChecked(ctx, o.generateText, KindContent, []Message{{Role: "user", Text: prompt}}, o.prompts.checkContent(input))
+}
+
+func (o *OpenAI) Refine(ctx context.Context, kind ContentKind, input *Input, history []Revision) (string, error) {
+	prompt, err := o.prompts.Render(kind, input)
+	if err != nil {
+		return "", err
+	}
+	return generateChecked(ctx, o.generateText, kind, refineMessages(prompt, kind, history), o.prompts.checkText(kind, input))
+}
+
+func (o *OpenAI) generate(ctx context.Context, kind ContentKind, input *Input) (string, error) {
+	prompt, err := o.prompts.Render(kind, input)
+	if err != nil {
+		return "", err
+	}
+	return generateChecked(ctx, o.generateText, kind, []Message{{Role: "user", Text: prompt}}, o.prompts.checkText(kind, input))
+}
+
+func (o *OpenAI) generateText(ctx context.Context, kind ContentKind, messages []Message) (string, error) {
+	maxTokens, ok := openAIMaxTokens[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown content kind %q", kind)
+	}
+	if o.slots != nil {
+		select {
+		case o.slots <- struct{}{}:
+			defer func() { <-o.slots }()
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	reqBody := OpenAIRequest{Model: o.Model, Temperature: o.Temperature, MaxTokens: maxTokens}
+	for _, message := range messages {
+		reqBody.Messages = append(reqBody.Messages, OpenAIMessage{Role: message.Role, Content: message.Text})
+	}
+
+	response, err := o.complete(ctx, &reqBody)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	choice := response.Choices[0]
+	if o.usage != nil {
+		o.usage.RecordUsage(Usage{
+			Kind:         kind,
+			Model:        o.Model,
+			Mode:         ModeSync,
+			InputTokens:  response.Usage.PromptTokens,
+			OutputTokens: response.Usage.CompletionTokens,
+			Status:       choice.FinishReason,
+		})
+	}
+	if choice.FinishReason == "content_filter" {
+		return "", fmt.Errorf("the %s was withheld by the content filter", kind)
+	}
+	return choice.Message.Content, nil
+}
+
+func (o *OpenAI) complete(ctx context.Context, reqBody *OpenAIRequest) (*OpenAIResponse, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := strings.TrimRight(o.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var response OpenAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &response, nil
+}
@@ -0,0 +1,101 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOpenAI_GeneratePRTitle(t *testing.T) {
+	finishReason := "stop"
+	var request OpenAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Expected the chat completions path, got %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("Expected bearer authorization, got %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		fmt.Fprintf(w, `{"model": "gpt-4o-mini", "choices": [{"message": {"role": "assistant", "content": "Add cache"}, "finish_reason": %q}],
+			"usage": {"prompt_tokens": 120, "completion_tokens": 8}}`, finishReason)
+	}))
+	defer server.Close()
+
+	openai := NewOpenAI("key", server.URL+"/v1/", "")
+	var records usageRecords
+	openai.SetUsageRecorder(&records)
+
+	title, err := openai.GeneratePRTitle(context.Background(), &Input{Diff: "diff"})
+	if err != nil || title != "Add cache" {
+		t.Fatalf("Expected the title from the first choice, got %q: %v", title, err)
+	}
+	if request.Model != DefaultOpenAIModel || request.MaxTokens != 200 || len(request.Messages) != 1 || request.Messages[0].Role != "user" {
+		t.Errorf("Unexpected request: %+v", request)
+	}
+	want := Usage{Kind: KindTitle, Model: DefaultOpenAIModel, Mode: ModeSync, InputTokens: 120, OutputTokens: 8, Status: "stop"}
+	if len(records) != 1 || records[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, records)
+	}
+
+	finishReason = "content_filter"
+	if _, err := openai.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err == nil || !strings.Contains(err.Error(), "content filter") {
+		t.Errorf("Expected a filtered answer to fail, got %v", err)
+	}
+}
+
+func TestOpenAI_withoutAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Expected no authorization without a key, got %q", auth)
+		}
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAI("", server.URL, "llama3").GenerateBranchName(context.Background(), &Input{Diff: "diff"})
+	if err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected the failed status in the error, got %v", err)
+	}
+}
+
+func TestOpenAI_concurrencyLimit(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "Add cache"}, "finish_reason": "stop"}]}`)
+	}))
+	defer server.Close()
+
+	openai := NewOpenAI("key", server.URL, "")
+	openai.SetConcurrency(2)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := openai.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight != 2 {
+		t.Errorf("Expected at most 2 requests at a time, got %d", maxInFlight)
+	}
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// PromptNames are the prompt templates that can be overridden. "content"
+// asks for everything at once, and "context" is a partial shared by the others.
+var PromptNames = []string{"title", "description", "branch", "content", "context"}
+
+// Prompts holds the prompt templates. Each one is the embedded default unless
+// a file <name>.tmpl in one of the override directories replaces it.
+type Prompts struct {
+	sources map[string]string
+	origins map[string]string
+	parsed  map[string]*template.Template
+}
+
+var promptFuncs = template.FuncMap{
+	"join":     strings.Join,
+	"truncate": truncateText,
+}
+
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+func DefaultPrompts() *Prompts {
+	prompts, err := LoadPrompts()
+	if err != nil {
+		panic(err)
+	}
+	return prompts
+}
+
+// LoadPrompts reads overrides from dirs, later directories winning over
+// earlier ones, and parses every template.
+func LoadPrompts(dirs ...string) (*Prompts, error) {
+	p := &Prompts{sources: map[string]string{}, origins: map[string]string{}, parsed: map[string]*template.Template{}}
+	for _, name := range PromptNames {
+		source, err := embeddedPrompts.ReadFile("prompts/" + name + ".tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded prompt %s: %w", name, err)
+		}
+		p.sources[name], p.origins[name] = string(source), "embedded"
+
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name+".tmpl")
+			source, err := os.ReadFile(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read prompt %s: %w", path, err)
+			}
+			p.sources[name], p.origins[name] = string(source), path
+		}
+	}
+
+	for _, name := range PromptNames {
+		if name == "context" {
+			continue
+		}
+		t, err := template.New(name).Funcs(promptFuncs).Parse(p.sources["context"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt context from %s: %w", p.origins["context"], err)
+		}
+		if t, err = t.Parse(p.sources[name]); err != nil {
+			return nil, fmt.Errorf("failed to parse prompt %s from %s: %w", name, p.origins[name], err)
+		}
+		p.parsed[name] = t
+	}
+	return p, nil
+}
+
+// Source returns the text of a template and the file it was read from, or
+// "embedded".
+func (p *Prompts) Source(name string) (source, origin string, err error) {
+	source, ok := p.sources[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown prompt %q (expected one of %s)", name, strings.Join(PromptNames, ", "))
+	}
+	return source, p.origins[name], nil
+}
+
+// Render executes the template for kind with input as its data.
+func (p *Prompts) Render(kind ContentKind, input *Input) (string, error) {
+	name := PromptName(kind)
+	t, ok := p.parsed[name]
+	if !ok {
+		return "", fmt.Errorf("unknown content kind %q", kind)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, input); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// PromptName maps a content kind to the name of its template.
+func PromptName(kind ContentKind) string {
+	if kind == KindBranchName {
+		return "branch"
+	}
+	return string(kind)
+}
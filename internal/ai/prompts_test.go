@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultPrompts_render(t *testing.T) {
+	prompts := DefaultPrompts()
+	input := &Input{Diff: "diff --git a/x b/x", Commits: []string{"Add cache"}}
+
+	title, err := prompts.Render(KindTitle, input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(title, "diff --git a/x b/x") || !strings.Contains(title, "- Add cache") {
+		t.Errorf("Expected diff and commits in prompt, got %s", title)
+	}
+	if strings.Contains(title, "issue") || strings.Contains(title, "Write the title in") {
+		t.Errorf("Expected no issue or language instructions, got %s", title)
+	}
+
+	input.Issue = &Issue{Key: "PROJ-1", Title: "Cache responses", Body: "Responses are slow."}
+	input.Language = "Russian"
+	for _, kind := range []ContentKind{KindTitle, KindDescription, KindBranchName} {
+		prompt, err := prompts.Render(kind, input)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", kind, err)
+		}
+		if !strings.Contains(prompt, "PROJ-1: Cache responses") || !strings.Contains(prompt, "Responses are slow.") {
+			t.Errorf("Expected issue context in %s prompt, got %s", kind, prompt)
+		}
+	}
+	if description, _ := prompts.Render(KindDescription, input); !strings.Contains(description, "Write the description in Russian.") {
+		t.Errorf("Expected language instruction, got %s", description)
+	}
+}
+
+func TestDefaultPrompts_conventionalTitle(t *testing.T) {
+	input := &Input{Diff: "diff --git a/x b/x", Conventional: &Conventional{Type: "fix", Scope: "pr"}}
+	prompt, err := DefaultPrompts().Render(KindTitle, input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(prompt, `"fix(pr): "`) || !strings.Contains(prompt, "Conventional Commits") {
+		t.Errorf("Expected conventional title prompt with inferred type and scope, got %s", prompt)
+	}
+}
+
+func TestLoadPrompts_overrides(t *testing.T) {
+	global, repo := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(global, "title.tmpl"), []byte("global {{.Branch}}"), 0o644)
+	os.WriteFile(filepath.Join(global, "branch.tmpl"), []byte("global branch {{.Ticket}}"), 0o644)
+	os.WriteFile(filepath.Join(repo, "title.tmpl"), []byte(`repo {{.Branch}} {{join .Files ","}}`), 0o644)
+
+	prompts, err := LoadPrompts(global, repo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	input := &Input{Branch: "feature/x", Ticket: "PROJ-1", Files: []string{"a.go", "b.go"}}
+
+	if got, _ := prompts.Render(KindTitle, input); got != "repo feature/x a.go,b.go" {
+		t.Errorf("Expected the repository override to win, got %q", got)
+	}
+	if got, _ := prompts.Render(KindBranchName, input); got != "global branch PROJ-1" {
+		t.Errorf("Expected the global override, got %q", got)
+	}
+	if _, origin, _ := prompts.Source("description"); origin != "embedded" {
+		t.Errorf("Expected the embedded description prompt, got %s", origin)
+	}
+	if _, origin, _ := prompts.Source("title"); origin != filepath.Join(repo, "title.tmpl") {
+		t.Errorf("Expected title from the repository, got %s", origin)
+	}
+}
+
+func TestLoadPrompts_invalidTemplate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "description.tmpl"), []byte("{{.Diff"), 0o644)
+
+	if _, err := LoadPrompts(dir); err == nil || !strings.Contains(err.Error(), "description.tmpl") {
+		t.Errorf("Expected parse error naming the file, got %v", err)
+	}
+}
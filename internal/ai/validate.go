@@ -0,0 +1,209 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTitleLength leaves a little room over the 70 characters the
+	// prompts ask for.
+	MaxTitleLength = 72
+	// MaxBranchNameLength is where generated branch names are cut, at a
+	// word boundary.
+	MaxBranchNameLength = 40
+
+	// minLeakLength is how long a line of the instructions must be to count
+	// as leaked when it turns up in an answer.
+	minLeakLength = 20
+)
+
+var (
+	// outputLabel matches labels models put in front of the answer, such as
+	// "Title:", "**Branch name:**" or "Here is the description:".
+	outputLabel = regexp.MustCompile(`(?i)^[#*_\s]*(?:here(?:'s| is)\b[^:\n]*|вот\b[^:\n]*|(?:suggested |proposed |pr |pull request )?(?:title|branch name|branch|description)|заголовок(?: pr| пулл-реквеста)?|название(?: ветки| pr)?|имя ветки|ветка|описание(?: pr| пулл-реквеста)?)[*_]*\s*:[*_]*[ \t]*`)
+
+	quotePairs = [][2]string{{`"`, `"`}, {"'", "'"}, {"`", "`"}, {"«", "»"}, {"“", "”"}, {"**", "**"}}
+)
+
+// ValidationError tells what is wrong with a generated field. Problem is
+// also sent back to the model to have it corrected.
+type ValidationError struct {
+	Kind    ContentKind
+	Problem string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Kind, e.Problem)
+}
+
+// CleanOutput strips what models wrap answers in: a code fence around the
+// whole answer, a leading label and, for titles and branch names, quotes
+// and a markdown heading. Branch names are also sanitized the way branch
+// names are made from any text: the prefix up to the last '/' is dropped,
+// Cyrillic is transliterated and the rest becomes lowercase kebab-case of
+// at most MaxBranchNameLength characters.
+func CleanOutput(kind ContentKind, text string) string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	text = unfence(text)
+	text = strings.TrimSpace(outputLabel.ReplaceAllString(text, ""))
+	if kind == KindDescription {
+		return unfence(text)
+	}
+
+	text = strings.TrimSpace(strings.TrimLeft(text, "#"))
+	for unquoted := true; unquoted; {
+		unquoted = false
+		for _, pair := range quotePairs {
+			if len(text) >= len(pair[0])+len(pair[1]) && strings.HasPrefix(text, pair[0]) && strings.HasSuffix(text, pair[1]) {
+				text = strings.TrimSpace(text[len(pair[0]) : len(text)-len(pair[1])])
+				unquoted = true
+			}
+		}
+	}
+	if kind == KindTitle && strings.HasSuffix(text, ".") && !strings.HasSuffix(text, "..") {
+		text = strings.TrimSuffix(text, ".")
+	}
+	if kind == KindBranchName {
+		text, _, _ = strings.Cut(text, "\n")
+		if i := strings.LastIndex(text, "/"); i >= 0 {
+			text = text[i+1:]
+		}
+		text = SanitizeBranchSlug(text, MaxBranchNameLength)
+	}
+	return text
+}
+
+// unfence returns the content of a code fence that makes up all of text.
+func unfence(text string) string {
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || strings.Count(text, "```") != 2 {
+		return text
+	}
+	_, inner, ok := strings.Cut(text, "\n")
+	if !ok {
+		return strings.TrimSpace(strings.Trim(text, "`"))
+	}
+	return strings.TrimSpace(strings.TrimSuffix(inner, "```"))
+}
+
+// ValidateOutput checks a cleaned field. instructions is the prompt without
+// the diff and the context: an answer repeating one of its lines leaked it.
+func ValidateOutput(kind ContentKind, text, instructions string) error {
+	invalid := func(format string, args ...any) error {
+		return &ValidationError{Kind: kind, Problem: fmt.Sprintf(format, args...)}
+	}
+	if strings.TrimSpace(text) == "" {
+		return invalid("it is empty")
+	}
+
+	switch kind {
+	case KindTitle:
+		if strings.Contains(text, "\n") {
+			return invalid("it must be a single line")
+		}
+		if n := utf8.RuneCountInString(text); n > MaxTitleLength {
+			return invalid("it has %d characters, the limit is %d", n, MaxTitleLength)
+		}
+	case KindDescription:
+		fences := 0
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "```") {
+				fences++
+			}
+			if strings.HasPrefix(line, "diff --git ") {
+				return invalid("it contains the diff instead of describing it")
+			}
+		}
+		if fences%2 != 0 {
+			return invalid("a code block is not closed")
+		}
+	}
+
+	for _, line := range strings.Split(instructions, "\n") {
+		line = strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(line), "- "), ".: ")
+		if len(line) >= minLeakLength && strings.Contains(text, line) {
+			return invalid("it repeats the instructions instead of following them")
+		}
+	}
+	return nil
+}
+
+// instructions renders the prompt of kind without the diff and the context,
+// for ValidateOutput. It is empty if the template cannot do without them.
+func (p *Prompts) instructions(kind ContentKind, input *Input) string {
+	text, err := p.Render(kind, &Input{Branch: input.Branch, Language: input.Language, Conventional: input.Conventional})
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+// checkText returns the check of a title, description or branch name
+// generated for input.
+func (p *Prompts) checkText(kind ContentKind, input *Input) func(string) (string, error) {
+	instructions := p.instructions(kind, input)
+	return func(text string) (string, error) {
+		text = CleanOutput(kind, text)
+		return text, ValidateOutput(kind, text, instructions)
+	}
+}
+
+// checkContent returns the check of a combined answer, which fails with
+// ErrMalformedContent so that callers can fall back to separate requests.
+func (p *Prompts) checkContent(input *Input) func(string) (*Content, error) {
+	instructions := p.instructions(KindContent, input)
+	return func(text string) (*Content, error) {
+		content, err := ParseContent(text, input)
+		if err != nil {
+			return nil, err
+		}
+		type field struct {
+			kind  ContentKind
+			value *string
+		}
+		fields := []field{{KindTitle, &content.Title}, {KindDescription, &content.Description}}
+		if input.Branch == "" {
+			fields = append(fields, field{KindBranchName, &content.BranchName})
+		}
+		for _, field := range fields {
+			*field.value = CleanOutput(field.kind, *field.value)
+			if err := ValidateOutput(field.kind, *field.value, instructions); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrMalformedContent, err)
+			}
+		}
+		return content, nil
+	}
+}
+
+// generateChecked sends messages with complete and checks the answer. An
+// answer that fails the check is sent back once, together with what is wrong
+// with it.
+func generateChecked[T any](ctx context.Context, complete func(context.Context, ContentKind, []Message) (string, error), kind ContentKind, messages []Message, check func(string) (T, error)) (T, error) {
+	var zero T
+	text, err := complete(ctx, kind, messages)
+	if err != nil {
+		return zero, err
+	}
+	value, err := check(text)
+	if err == nil {
+		return value, nil
+	}
+
+	expected := string(kind)
+	if kind == KindContent {
+		expected = "JSON object"
+	}
+	messages = append(messages[:len(messages):len(messages)],
+		Message{Role: "assistant", Text: text},
+		Message{Role: "user", Text: fmt.Sprintf("This answer is not valid: %v. Return only the corrected %s, no additional text.", err, expected)},
+	)
+	text, err = complete(ctx, kind, messages)
+	if err != nil {
+		return zero, err
+	}
+	return check(text)
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCleanAndValidateOutput runs the corpus of bad answers in
+// testdata/outputs.json: each is either cleaned into want or rejected with
+// an error containing error.
+func TestCleanAndValidateOutput(t *testing.T) {
+	data, err := os.ReadFile("testdata/outputs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Name   string
+		Kind   ContentKind
+		Output string
+		Want   string
+		Error  string
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	prompts := DefaultPrompts()
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cleaned := CleanOutput(tc.Kind, tc.Output)
+			err := ValidateOutput(tc.Kind, cleaned, prompts.instructions(tc.Kind, &Input{}))
+			if tc.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.Error) {
+					t.Errorf("Expected an error containing %q for %q, got %v", tc.Error, cleaned, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if cleaned != tc.Want {
+				t.Errorf("Expected %q, got %q", tc.Want, cleaned)
+			}
+		})
+	}
+}
+
+// answeringServer answers YandexGPT requests with answers in turn and keeps
+// the messages of each request.
+func answeringServer(t *testing.T, answers ...string) (*httptest.Server, *[][]Message) {
+	var requests [][]Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req YandexGPTRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req.Messages)
+		answer := answers[min(len(requests), len(answers))-1]
+		json.NewEncoder(w).Encode(YandexGPTResponse{Result: Result{Alternatives: []Alternative{{Message: Message{Role: "assistant", Text: answer}}}}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestYandexGPT_repromptsInvalidOutput(t *testing.T) {
+	server, requests := answeringServer(t, "`キャッシュ`", "feature/add-response-cache")
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL
+
+	branch, err := yandex.GenerateBranchName(context.Background(), &Input{Diff: "diff"})
+	if err != nil || branch != "add-response-cache" {
+		t.Fatalf("Expected the corrected branch name, got %q: %v", branch, err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("Expected one correction request, got %d requests", len(*requests))
+	}
+	correction := (*requests)[1]
+	if len(correction) != 3 || correction[1].Text != "`キャッシュ`" || !strings.Contains(correction[2].Text, "it is empty") {
+		t.Errorf("Expected the answer and what is wrong with it to be sent back, got %+v", correction)
+	}
+
+	server, requests = answeringServer(t, "Add response cache\n\nAdds a disk cache.")
+	yandex.Endpoint = server.URL
+	var validationErr *ValidationError
+	if _, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); !errors.As(err, &validationErr) || validationErr.Kind != KindTitle {
+		t.Errorf("Expected a validation error after the correction failed, got %v", err)
+	}
+	if len(*requests) != 2 {
+		t.Errorf("Expected a single correction request, got %d requests", len(*requests))
+	}
+}
+
+func TestYandexGPT_GenerateContent_reprompts(t *testing.T) {
+	server, requests := answeringServer(t,
+		`{"branch_name": "feature/add-cache", "title": "Add cache\n\nAdds a cache.", "description": "Adds a cache."}`,
+		"```json\n{\"branch_name\": \"add-cache\", \"title\": \"Title: Add cache.\", \"description\": \"Adds a cache.\"}\n```")
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL
+
+	content, err := yandex.GenerateContent(context.Background(), &Input{Diff: "diff"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content.BranchName != "add-cache" || content.Title != "Add cache" || len(*requests) != 2 {
+		t.Errorf("Expected cleaned content after one correction, got %+v after %d requests", content, len(*requests))
+	}
+	if correction := (*requests)[1]; !strings.Contains(correction[len(correction)-1].Text, "corrected JSON object") {
+		t.Errorf("Expected a correction asking for the JSON object, got %q", correction[len(correction)-1].Text)
+	}
+
+	server, _ = answeringServer(t, "no JSON here")
+	yandex.Endpoint = server.URL
+	if _, err := yandex.GenerateContent(context.Background(), &Input{Diff: "diff"}); !errors.Is(err, ErrMalformedContent) {
+		t.Errorf("Expected ErrMalformedContent, got %v", err)
+	}
+}
@@ -3,16 +3,81 @@ package ai
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deck/branchtale/internal/httpclient"
+)
+
+const (
+	DefaultYandexEndpoint    = "https://llm.api.cloud.yandex.net/foundationModels/v1/completion"
+	DefaultOperationEndpoint = "https://operation.api.cloud.yandex.net/operations"
+
+	// Modes of a completion request: a synchronous call, an asynchronous
+	// operation that is polled until done, or a stream of partial results.
+	ModeSync   = "sync"
+	ModeAsync  = "async"
+	ModeStream = "stream"
+
+	// DefaultYandexConcurrency is how many requests run at the same time
+	// unless SetConcurrency says otherwise.
+	DefaultYandexConcurrency = 3
 )
 
 type YandexGPT struct {
 	APIKey   string
 	FolderID string
-	client   *http.Client
+	// Endpoint is the completion URL; asynchronous requests go to the same
+	// URL with an "Async" suffix.
+	Endpoint          string
+	OperationEndpoint string
+	client            *http.Client
+	streamClient      *http.Client
+	pollInterval      time.Duration
+	slots             chan struct{}
+	usage             UsageRecorder
+	auth              YandexAuth
+	prompts           *Prompts
+	options           map[ContentKind]YandexOptions
+}
+
+// YandexOptions are the completion settings used for one kind of content.
+// Model is a model URI such as gpt://<folder>/yandexgpt/rc or
+// ds://<fine-tuned model>, or a model name such as yandexgpt/latest that is
+// resolved within the folder.
+type YandexOptions struct {
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	Mode        string
+}
+
+// DefaultYandexOptions returns the settings used unless configured otherwise.
+func DefaultYandexOptions() map[ContentKind]YandexOptions {
+	return map[ContentKind]YandexOptions{
+		KindTitle:       {Model: "yandexgpt-lite/latest", Temperature: 0.3, MaxTokens: 200},
+		KindDescription: {Model: "yandexgpt-lite/latest", Temperature: 0.3, MaxTokens: 1000},
+		KindBranchName:  {Model: "yandexgpt-lite/latest", Temperature: 0.3, MaxTokens: 100},
+		KindContent:     {Model: "yandexgpt-lite/latest", Temperature: 0.3, MaxTokens: 1500},
+	}
+}
+
+// ModelURI resolves a model name within folderID. Full gpt:// and ds:// URIs
+// are used as they are, and a name without a version gets /latest.
+func ModelURI(folderID, model string) string {
+	if strings.Contains(model, "://") {
+		return model
+	}
+	if !strings.Contains(model, "/") {
+		model += "/latest"
+	}
+	return fmt.Sprintf("gpt://%s/%s", folderID, model)
 }
 
 type YandexGPTRequest struct {
@@ -37,104 +102,262 @@ type YandexGPTResponse struct {
 }
 
 type Result struct {
-	Alternatives []Alternative `json:"alternatives"`
+	Alternatives []Alternative   `json:"alternatives"`
+	Usage        CompletionUsage `json:"usage"`
+	ModelVersion string          `json:"modelVersion"`
 }
 
+// Statuses of an alternative. A truncated answer hit the token limit; a
+// filtered one holds a refusal instead of the requested text.
+const (
+	StatusFinal         = "ALTERNATIVE_STATUS_FINAL"
+	StatusTruncated     = "ALTERNATIVE_STATUS_TRUNCATED_FINAL"
+	StatusContentFilter = "ALTERNATIVE_STATUS_CONTENT_FILTER"
+)
+
 type Alternative struct {
 	Message Message `json:"message"`
 	Status  string  `json:"status"`
 }
 
+type CompletionUsage struct {
+	InputTextTokens  TokenCount `json:"inputTextTokens"`
+	CompletionTokens TokenCount `json:"completionTokens"`
+	TotalTokens      TokenCount `json:"totalTokens"`
+}
+
+// TokenCount reads counts that the API encodes as strings, like every int64
+// in its JSON, as well as plain numbers.
+type TokenCount int
+
+func (c *TokenCount) UnmarshalJSON(data []byte) error {
+	n, err := strconv.Atoi(strings.Trim(string(data), `"`))
+	if err != nil {
+		return fmt.Errorf("invalid token count %s", data)
+	}
+	*c = TokenCount(n)
+	return nil
+}
+
 func NewYandexGPT(apiKey, folderID string) *YandexGPT {
 	return &YandexGPT{
-		APIKey:   apiKey,
-		FolderID: folderID,
-		client:   &http.Client{},
+		APIKey:            apiKey,
+		FolderID:          folderID,
+		Endpoint:          DefaultYandexEndpoint,
+		OperationEndpoint: DefaultOperationEndpoint,
+		client:            httpclient.New(httpclient.Options{}),
+		streamClient:      httpclient.New(httpclient.Options{Timeout: streamTimeout}),
+		pollInterval:      time.Second,
+		slots:             make(chan struct{}, DefaultYandexConcurrency),
+		prompts:           DefaultPrompts(),
+		options:           DefaultYandexOptions(),
+	}
+}
+
+// SetPrompts replaces the default prompt templates.
+func (y *YandexGPT) SetPrompts(prompts *Prompts) {
+	y.prompts = prompts
+}
+
+// SetAuth replaces API key authentication, e.g. with IAMTokenAuth or
+// ServiceAccountAuth.
+func (y *YandexGPT) SetAuth(auth YandexAuth) {
+	y.auth = auth
+}
+
+// SetUsageRecorder receives the token usage of every completion.
+func (y *YandexGPT) SetUsageRecorder(r UsageRecorder) {
+	y.usage = r
+}
+
+// SetConcurrency limits how many requests are in flight at the same time;
+// further ones wait for a free slot. n <= 0 removes the limit.
+func (y *YandexGPT) SetConcurrency(n int) {
+	y.slots = nil
+	if n > 0 {
+		y.slots = make(chan struct{}, n)
 	}
 }
 
-func (y *YandexGPT) GeneratePRTitle(ctx context.Context, diff string) (string, error) {
-	prompt := fmt.Sprintf(
-		"Generate a concise and descriptive pull request title based on the following git diff. "+
-			"The title should be in imperative mood, start with a verb, and be under 70 characters:\n\n%s\n\n"+
-			"Return only the title, no additional text.",
-		diff,
-	)
+func (y *YandexGPT) Options(kind ContentKind) YandexOptions {
+	return y.options[kind]
+}
+
+func (y *YandexGPT) SetOptions(kind ContentKind, options YandexOptions) {
+	y.options[kind] = options
+}
 
-	return y.generateText(ctx, prompt)
+// Fingerprint identifies what an answer for kind depends on besides the
+// input: the model, its settings and the prompt templates.
+func (y *YandexGPT) Fingerprint(kind ContentKind) string {
+	options := y.options[kind]
+	source, _, _ := y.prompts.Source(PromptName(kind))
+	partial, _, _ := y.prompts.Source("context")
+	sum := sha256.Sum256([]byte(source + partial))
+	return fmt.Sprintf("%s %g %d %x", ModelURI(y.FolderID, options.Model), options.Temperature, options.MaxTokens, sum[:8])
 }
 
-func (y *YandexGPT) GeneratePRDescription(ctx context.Context, diff string) (string, error) {
-	prompt := fmt.Sprintf(
-		"Generate a pull request description based on the following git diff. It must be short and concise. A few sentences what's done.\n\n"+
-			"Format the response in markdown:\n\n%s",
-		diff,
-	)
+func (y *YandexGPT) GeneratePRTitle(ctx context.Context, input *Input) (string, error) {
+	return y.generate(ctx, KindTitle, input)
+}
 
-	return y.generateText(ctx, prompt)
+func (y *YandexGPT) GeneratePRDescription(ctx context.Context, input *Input) (string, error) {
+	return y.generate(ctx, KindDescription, input)
 }
 
-func (y *YandexGPT) GenerateBranchName(ctx context.Context, diff string) (string, error) {
-	prompt := "Generate a short branch name based on the following git diff. The name should:\n" +
-		"- Be descriptive but concise\n" +
-		"- Use kebab-case (lowercase with hyphens)\n" +
-		"- Be under 40 characters\n" +
-		"- Not include any prefixes\n\n" +
-		diff +
-		"\n\nReturn only the branch name, no additional text."
+func (y *YandexGPT) GenerateBranchName(ctx context.Context, input *Input) (string, error) {
+	return y.generate(ctx, KindBranchName, input)
+}
 
-	return y.generateText(ctx, prompt)
+// GenerateContent asks for everything in one request. An answer that is not
+// the expected JSON object fails with ErrMalformedContent.
+func (y *YandexGPT) GenerateContent(ctx context.Context, input *Input) (*Content, error) {
+	prompt, err := y.prompts.Render(KindContent, input)
+	if err != nil {
+		return nil, err
+	}
+	return generateChecked(ctx, y.generateText, KindContent, []Message{{Role: "user", Text: prompt}}, y.prompts.checkContent(input))
 }
 
-func (y *YandexGPT) generateText(ctx context.Context, prompt string) (string, error) {
+func (y *YandexGPT) Refine(ctx context.Context, kind ContentKind, input *Input, history []Revision) (string, error) {
+	prompt, err := y.prompts.Render(kind, input)
+	if err != nil {
+		return "", err
+	}
+	return generateChecked(ctx, y.generateText, kind, refineMessages(prompt, kind, history), y.prompts.checkText(kind, input))
+}
+
+func (y *YandexGPT) generate(ctx context.Context, kind ContentKind, input *Input) (string, error) {
+	prompt, err := y.prompts.Render(kind, input)
+	if err != nil {
+		return "", err
+	}
+	return generateChecked(ctx, y.generateText, kind, []Message{{Role: "user", Text: prompt}}, y.prompts.checkText(kind, input))
+}
+
+func refineMessages(prompt string, kind ContentKind, history []Revision) []Message {
+	messages := []Message{{Role: "user", Text: prompt}}
+	for _, revision := range history {
+		messages = append(messages,
+			Message{Role: "assistant", Text: revision.Output},
+			Message{Role: "user", Text: fmt.Sprintf("%s\n\nRevise the %s accordingly. Return only the %s, no additional text.", revision.Feedback, kind, kind)},
+		)
+	}
+	return messages
+}
+
+func (y *YandexGPT) generateText(ctx context.Context, kind ContentKind, messages []Message) (string, error) {
+	options, ok := y.options[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown content kind %q", kind)
+	}
+	if y.slots != nil {
+		select {
+		case y.slots <- struct{}{}:
+			defer func() { <-y.slots }()
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
 	reqBody := YandexGPTRequest{
-		ModelURI: fmt.Sprintf("gpt://%s/yandexgpt-lite/latest", y.FolderID),
+		ModelURI: ModelURI(y.FolderID, options.Model),
 		CompletionOptions: CompletionOptions{
-			Stream:      false,
-			Temperature: 0.3,
-			MaxTokens:   500,
-		},
-		Messages: []Message{
-			{
-				Role: "user",
-				Text: prompt,
-			},
+			Stream:      options.Mode == ModeStream,
+			Temperature: options.Temperature,
+			MaxTokens:   options.MaxTokens,
 		},
+		Messages: messages,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	var result *Result
+	var err error
+	switch options.Mode {
+	case ModeAsync:
+		result, err = y.completeAsync(ctx, &reqBody)
+	case ModeStream:
+		result, err = y.completeStream(ctx, &reqBody)
+	default:
+		result, err = y.complete(ctx, &reqBody)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://llm.api.cloud.yandex.net/foundationModels/v1/completion", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
+	}
+	if len(result.Alternatives) == 0 {
+		return "", fmt.Errorf("no alternatives in response")
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Api-Key %s", y.APIKey))
+	alternative := result.Alternatives[0]
+	if y.usage != nil {
+		mode := options.Mode
+		if mode == "" {
+			mode = ModeSync
+		}
+		y.usage.RecordUsage(Usage{
+			Kind:         kind,
+			Model:        options.Model,
+			Mode:         mode,
+			InputTokens:  int(result.Usage.InputTextTokens),
+			OutputTokens: int(result.Usage.CompletionTokens),
+			Status:       alternative.Status,
+		})
+	}
+	if alternative.Status == StatusContentFilter {
+		return "", fmt.Errorf("the %s was withheld by the content filter", kind)
+	}
+	return alternative.Message.Text, nil
+}
 
-	resp, err := y.client.Do(req)
+func (y *YandexGPT) complete(ctx context.Context, reqBody *YandexGPTRequest) (*Result, error) {
+	resp, err := y.send(ctx, y.client, http.MethodPost, y.Endpoint, reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	var response YandexGPTResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	return &response.Result, nil
+}
 
-	var response YandexGPTResponse
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+// send makes an authenticated request with body as JSON, if not nil, and
+// returns the response if its status is 200.
+func (y *YandexGPT) send(ctx context.Context, client *http.Client, method, url string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewBuffer(jsonData)
 	}
 
-	if len(response.Result.Alternatives) == 0 {
-		return "", fmt.Errorf("no alternatives in response")
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	return response.Result.Alternatives[0].Message.Text, nil
+	req.Header.Set("Content-Type", "application/json")
+	var auth YandexAuth = APIKeyAuth(y.APIKey)
+	if y.auth != nil {
+		auth = y.auth
+	}
+	authorization, err := auth.Authorization(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
 }
@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// streamTimeout limits a whole streamed answer, which may take longer than a
+// synchronous request is allowed to.
+const streamTimeout = 5 * time.Minute
+
+// Operation is a long-running operation started by completionAsync.
+type Operation struct {
+	ID       string          `json:"id"`
+	Done     bool            `json:"done"`
+	Response *Result         `json:"response,omitempty"`
+	Error    *OperationError `json:"error,omitempty"`
+}
+
+type OperationError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type streamOutputKey struct{}
+
+// WithStreamOutput shows the text streamed for requests made with ctx on w,
+// so that concurrent requests do not write to the same place. Without it
+// streamed text is not shown.
+func WithStreamOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, streamOutputKey{}, w)
+}
+
+// completeAsync starts a completion operation and polls it until it is done
+// or ctx is cancelled.
+func (y *YandexGPT) completeAsync(ctx context.Context, reqBody *YandexGPTRequest) (*Result, error) {
+	resp, err := y.send(ctx, y.client, http.MethodPost, y.Endpoint+"Async", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	var operation Operation
+	err = json.NewDecoder(resp.Body).Decode(&operation)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode operation: %w", err)
+	}
+	if operation.ID == "" {
+		return nil, fmt.Errorf("no operation id in response")
+	}
+
+	for !operation.Done {
+		timer := time.NewTimer(y.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("stopped waiting for operation %s: %w", operation.ID, ctx.Err())
+		case <-timer.C:
+		}
+
+		resp, err := y.send(ctx, y.client, http.MethodGet, strings.TrimRight(y.OperationEndpoint, "/")+"/"+operation.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll operation %s: %w", operation.ID, err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&operation)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode operation: %w", err)
+		}
+	}
+
+	if operation.Error != nil {
+		return nil, fmt.Errorf("operation %s failed with code %d: %s", operation.ID, operation.Error.Code, operation.Error.Message)
+	}
+	if operation.Response == nil {
+		return nil, fmt.Errorf("no alternatives in response")
+	}
+	return operation.Response, nil
+}
+
+// completeStream reads the stream of partial results, each holding the text
+// generated so far, and shows what is new in each of them. The last result
+// holds the whole text and the usage.
+func (y *YandexGPT) completeStream(ctx context.Context, reqBody *YandexGPTRequest) (*Result, error) {
+	resp, err := y.send(ctx, y.streamClient, http.MethodPost, y.Endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	output, _ := ctx.Value(streamOutputKey{}).(io.Writer)
+
+	var last *Result
+	text := ""
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk YandexGPTResponse
+		err := decoder.Decode(&chunk)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to decode streamed response: %w", err)
+		}
+		if len(chunk.Result.Alternatives) == 0 {
+			continue
+		}
+		last = &chunk.Result
+
+		next := chunk.Result.Alternatives[0].Message.Text
+		if output != nil && strings.HasPrefix(next, text) {
+			fmt.Fprint(output, next[len(text):])
+		}
+		text = next
+	}
+
+	if output != nil && text != "" {
+		fmt.Fprintln(output)
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no alternatives in response")
+	}
+	return last, nil
+}
@@ -0,0 +1,173 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newAsyncTestServer(t *testing.T, polls int, final Operation) (*httptest.Server, *int) {
+	polled := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/completionAsync":
+			json.NewEncoder(w).Encode(Operation{ID: "op-1"})
+		case r.Method == http.MethodGet && r.URL.Path == "/operations/op-1":
+			polled++
+			if polled < polls {
+				json.NewEncoder(w).Encode(Operation{ID: "op-1"})
+				return
+			}
+			json.NewEncoder(w).Encode(final)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &polled
+}
+
+func newModeTestYandex(server *httptest.Server, mode string) *YandexGPT {
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL + "/completion"
+	yandex.OperationEndpoint = server.URL + "/operations"
+	yandex.pollInterval = time.Millisecond
+	options := yandex.Options(KindDescription)
+	options.Mode = mode
+	yandex.SetOptions(KindDescription, options)
+	return yandex
+}
+
+func TestYandexGPT_async(t *testing.T) {
+	final := Operation{ID: "op-1", Done: true, Response: &Result{Alternatives: []Alternative{{Message: Message{Text: "Adds a cache."}}}}}
+	server, polled := newAsyncTestServer(t, 3, final)
+
+	description, err := newModeTestYandex(server, ModeAsync).GeneratePRDescription(context.Background(), &Input{Diff: "diff"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if description != "Adds a cache." || *polled != 3 {
+		t.Errorf("Expected the result after 3 polls, got %q after %d", description, *polled)
+	}
+}
+
+func TestYandexGPT_asyncOperationError(t *testing.T) {
+	final := Operation{ID: "op-1", Done: true, Error: &OperationError{Code: 8, Message: "quota exceeded"}}
+	server, _ := newAsyncTestServer(t, 1, final)
+
+	_, err := newModeTestYandex(server, ModeAsync).GeneratePRDescription(context.Background(), &Input{Diff: "diff"})
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("Expected the operation error, got %v", err)
+	}
+}
+
+func TestYandexGPT_asyncCancelled(t *testing.T) {
+	server, _ := newAsyncTestServer(t, 1000000, Operation{})
+	yandex := newModeTestYandex(server, ModeAsync)
+	yandex.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := yandex.GeneratePRDescription(ctx, &Input{Diff: "diff"}); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Expected polling to stop with the context, got %v", err)
+	}
+}
+
+func TestYandexGPT_stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req YandexGPTRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.CompletionOptions.Stream {
+			t.Error("Expected a streaming request")
+		}
+		for _, text := range []string{"Adds", "Adds a cache", "Adds a cache."} {
+			fmt.Fprintf(w, `{"result":{"alternatives":[{"message":{"role":"assistant","text":%q},"status":"ALTERNATIVE_STATUS_PARTIAL"}]}}`+"\n", text)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	yandex := newModeTestYandex(server, ModeStream)
+	output := &bytes.Buffer{}
+
+	description, err := yandex.GeneratePRDescription(WithStreamOutput(context.Background(), output), &Input{Diff: "diff"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if description != "Adds a cache." {
+		t.Errorf("Expected the final text, got %q", description)
+	}
+	if output.String() != "Adds a cache.\n" {
+		t.Errorf("Expected each new part to be shown once, got %q", output.String())
+	}
+
+	requestOutput := &bytes.Buffer{}
+	if _, err := yandex.GeneratePRDescription(WithStreamOutput(context.Background(), requestOutput), &Input{Diff: "diff"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requestOutput.String() != "Adds a cache.\n" || output.String() != "Adds a cache.\n" {
+		t.Errorf("Expected the text on the writer of the context only, got %q and %q", requestOutput.String(), output.String())
+	}
+	if _, err := yandex.GeneratePRDescription(context.Background(), &Input{Diff: "diff"}); err != nil {
+		t.Errorf("Expected streaming without a writer to work, got %v", err)
+	}
+}
+
+func TestYandexGPT_streamCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"result":{"alternatives":[{"message":{"text":"Adds"}}]}}`)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := newModeTestYandex(server, ModeStream).GeneratePRDescription(ctx, &Input{Diff: "diff"}); err == nil {
+		t.Error("Expected the stream to stop with the context")
+	}
+}
+
+func TestYandexGPT_concurrencyLimit(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		json.NewEncoder(w).Encode(YandexGPTResponse{Result: Result{Alternatives: []Alternative{{Message: Message{Text: "Add cache"}}}}})
+	}))
+	defer server.Close()
+
+	yandex := newModeTestYandex(server, ModeSync)
+	yandex.SetConcurrency(2)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight != 2 {
+		t.Errorf("Expected at most 2 requests at a time, got %d", maxInFlight)
+	}
+}
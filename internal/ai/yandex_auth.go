@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deck/branchtale/internal/httpclient"
+)
+
+const (
+	DefaultIAMEndpoint = "https://iam.api.cloud.yandex.net/iam/v1/tokens"
+
+	// iamRefreshMargin is how long before expiry a cached IAM token is replaced.
+	iamRefreshMargin = 5 * time.Minute
+	jwtLifetime      = time.Hour
+)
+
+// YandexAuth returns the Authorization header for YandexGPT requests.
+type YandexAuth interface {
+	Authorization(ctx context.Context) (string, error)
+}
+
+type APIKeyAuth string
+
+func (k APIKeyAuth) Authorization(ctx context.Context) (string, error) {
+	return "Api-Key " + string(k), nil
+}
+
+// IAMTokenAuth uses a short-lived IAM token obtained elsewhere, e.g. with
+// yc iam create-token.
+type IAMTokenAuth string
+
+func (t IAMTokenAuth) Authorization(ctx context.Context) (string, error) {
+	return "Bearer " + string(t), nil
+}
+
+// ServiceAccountKey is an authorized key of a service account as written by
+// yc iam key create.
+type ServiceAccountKey struct {
+	ID               string `json:"id"`
+	ServiceAccountID string `json:"service_account_id"`
+	PrivateKey       string `json:"private_key"`
+}
+
+func LoadServiceAccountKey(path string) (*ServiceAccountKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key: %w", err)
+	}
+	var key ServiceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key %s: %w", path, err)
+	}
+	if key.ID == "" || key.ServiceAccountID == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("service account key %s needs id, service_account_id and private_key", path)
+	}
+	return &key, nil
+}
+
+// ServiceAccountAuth exchanges a PS256-signed JWT for an IAM token and caches
+// the token until shortly before it expires.
+type ServiceAccountAuth struct {
+	key        *ServiceAccountKey
+	privateKey *rsa.PrivateKey
+	endpoint   string
+	client     *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewServiceAccountAuth(key *ServiceAccountKey, endpoint string) (*ServiceAccountAuth, error) {
+	privateKey, err := parsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		endpoint = DefaultIAMEndpoint
+	}
+	// Exchanging the JWT for a token can be repeated safely.
+	return &ServiceAccountAuth{
+		key:        key,
+		privateKey: privateKey,
+		endpoint:   endpoint,
+		client:     httpclient.New(httpclient.Options{RetryAllMethods: true}),
+		now:        time.Now,
+	}, nil
+}
+
+// parsePrivateKey reads the PEM key; the comment line Yandex Cloud puts in
+// front of it is skipped by pem.Decode.
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("service account private key is not in PEM format")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("failed to parse service account private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func (a *ServiceAccountAuth) Authorization(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == "" || !a.now().Add(iamRefreshMargin).Before(a.expiresAt) {
+		if err := a.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+	return "Bearer " + a.token, nil
+}
+
+type iamTokenResponse struct {
+	IAMToken  string    `json:"iamToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (a *ServiceAccountAuth) refresh(ctx context.Context) error {
+	jwt, err := a.signedJWT()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"jwt": jwt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal IAM request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create IAM request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request IAM token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("IAM token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token iamTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode IAM token: %w", err)
+	}
+	if token.IAMToken == "" {
+		return fmt.Errorf("no IAM token in response")
+	}
+	a.token, a.expiresAt = token.IAMToken, token.ExpiresAt
+	return nil
+}
+
+func (a *ServiceAccountAuth) signedJWT() (string, error) {
+	now := a.now()
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "PS256", "kid": a.key.ID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss": a.key.ServiceAccountID,
+		"aud": a.endpoint,
+		"iat": now.Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPSS(rand.Reader, a.privateKey, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
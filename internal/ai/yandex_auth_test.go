@@ -0,0 +1,165 @@
+package ai
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServiceAccountKey(t *testing.T) (*ServiceAccountKey, *rsa.PrivateKey) {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := "PLEASE DO NOT REMOVE THIS LINE! Yandex.Cloud SA Key ID <key-id>\n" +
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	return &ServiceAccountKey{ID: "key-id", ServiceAccountID: "sa-id", PrivateKey: pemKey}, privateKey
+}
+
+// newFakeIAM verifies the signed JWT like the IAM endpoint does and issues a
+// token that expires after lifetime.
+func newFakeIAM(t *testing.T, publicKey *rsa.PublicKey, lifetime time.Duration, now func() time.Time) (*httptest.Server, *int) {
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			JWT string `json:"jwt"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		parts := strings.Split(req.JWT, ".")
+		if len(parts) != 3 {
+			http.Error(w, "malformed jwt", http.StatusBadRequest)
+			return
+		}
+
+		var header, claims map[string]any
+		headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		json.Unmarshal(headerJSON, &header)
+		json.Unmarshal(claimsJSON, &claims)
+		if header["alg"] != "PS256" || header["kid"] != "key-id" {
+			http.Error(w, fmt.Sprintf("unexpected header %v", header), http.StatusBadRequest)
+			return
+		}
+		if claims["iss"] != "sa-id" || claims["aud"] != "http://"+r.Host+r.URL.Path {
+			http.Error(w, fmt.Sprintf("unexpected claims %v", claims), http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPSS(publicKey, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		issued++
+		json.NewEncoder(w).Encode(iamTokenResponse{IAMToken: fmt.Sprintf("token-%d", issued), ExpiresAt: now().Add(lifetime)})
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func TestServiceAccountAuth_cachesAndRefreshes(t *testing.T) {
+	key, privateKey := newTestServiceAccountKey(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	server, issued := newFakeIAM(t, &privateKey.PublicKey, 12*time.Hour, clock)
+
+	auth, err := NewServiceAccountAuth(key, server.URL+"/iam/v1/tokens")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	auth.now = clock
+
+	for range 2 {
+		authorization, err := auth.Authorization(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if authorization != "Bearer token-1" {
+			t.Errorf("Expected cached token, got %s", authorization)
+		}
+	}
+	if *issued != 1 {
+		t.Errorf("Expected one IAM request, got %d", *issued)
+	}
+
+	now = now.Add(12*time.Hour - time.Minute)
+	authorization, err := auth.Authorization(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if authorization != "Bearer token-2" {
+		t.Errorf("Expected a new token shortly before expiry, got %s", authorization)
+	}
+}
+
+func TestServiceAccountAuth_rejected(t *testing.T) {
+	key, _ := newTestServiceAccountKey(t)
+	_, otherKey := newTestServiceAccountKey(t)
+	server, _ := newFakeIAM(t, &otherKey.PublicKey, time.Hour, time.Now)
+
+	auth, err := NewServiceAccountAuth(key, server.URL+"/iam/v1/tokens")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := auth.Authorization(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the IAM error to be reported, got %v", err)
+	}
+}
+
+func TestLoadServiceAccountKey(t *testing.T) {
+	key, _ := newTestServiceAccountKey(t)
+	path := filepath.Join(t.TempDir(), "key.json")
+	data, _ := json.Marshal(key)
+	os.WriteFile(path, data, 0o600)
+
+	loaded, err := LoadServiceAccountKey(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.ServiceAccountID != "sa-id" {
+		t.Errorf("Unexpected key: %+v", loaded)
+	}
+
+	os.WriteFile(path, []byte(`{"id": "key-id"}`), 0o600)
+	if _, err := LoadServiceAccountKey(path); err == nil {
+		t.Error("Expected error for incomplete key")
+	}
+}
+
+func TestYandexGPT_iamToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer iam-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(YandexGPTResponse{Result: Result{Alternatives: []Alternative{{Message: Message{Text: "Add cache"}}}}})
+	}))
+	defer server.Close()
+
+	yandex := NewYandexGPT("", "folder")
+	yandex.Endpoint = server.URL
+	yandex.SetAuth(IAMTokenAuth("iam-token"))
+	if title, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err != nil || title != "Add cache" {
+		t.Errorf("Unexpected result %q: %v", title, err)
+	}
+}
@@ -1,6 +1,12 @@
 package ai
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -90,3 +96,153 @@ func TestMessage_Structure(t *testing.T) {
 		t.Errorf("Expected Text to be 'Generate a branch name', got %s", msg.Text)
 	}
 }
+
+func TestRefineMessages(t *testing.T) {
+	history := []Revision{
+		{Output: "Add stuff", Feedback: "Be more specific"},
+		{Output: "Add response cache", Feedback: "Mention the TTL"},
+	}
+
+	messages := refineMessages("original prompt", KindTitle, history)
+
+	if len(messages) != 5 {
+		t.Fatalf("Expected 5 messages, got %d", len(messages))
+	}
+	expectedRoles := []string{"user", "assistant", "user", "assistant", "user"}
+	for i, role := range expectedRoles {
+		if messages[i].Role != role {
+			t.Errorf("Expected message %d role %s, got %s", i, role, messages[i].Role)
+		}
+	}
+	if messages[0].Text != "original prompt" {
+		t.Errorf("Expected original prompt first, got %s", messages[0].Text)
+	}
+	if messages[3].Text != "Add response cache" {
+		t.Errorf("Expected previous output as assistant message, got %s", messages[3].Text)
+	}
+	if !strings.HasPrefix(messages[4].Text, "Mention the TTL") {
+		t.Errorf("Expected latest feedback last, got %s", messages[4].Text)
+	}
+}
+
+func TestModelURI(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"yandexgpt-lite/latest", "gpt://folder/yandexgpt-lite/latest"},
+		{"yandexgpt/rc", "gpt://folder/yandexgpt/rc"},
+		{"yandexgpt", "gpt://folder/yandexgpt/latest"},
+		{"gpt://other/yandexgpt/latest", "gpt://other/yandexgpt/latest"},
+		{"ds://bt1234567890", "ds://bt1234567890"},
+	}
+
+	for _, tt := range tests {
+		if got := ModelURI("folder", tt.model); got != tt.want {
+			t.Errorf("ModelURI(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestYandexGPT_optionsPerOperation(t *testing.T) {
+	var requests []YandexGPTRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Api-Key key" {
+			t.Errorf("Unexpected authorization header %q", r.Header.Get("Authorization"))
+		}
+		var req YandexGPTRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		json.NewEncoder(w).Encode(YandexGPTResponse{Result: Result{Alternatives: []Alternative{{Message: Message{Role: "assistant", Text: "generated"}}}}})
+	}))
+	defer server.Close()
+
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL
+	yandex.SetOptions(KindDescription, YandexOptions{Model: "ds://tuned", Temperature: 0.6, MaxTokens: 2000})
+
+	input := &Input{Diff: "diff"}
+	if _, err := yandex.GeneratePRDescription(context.Background(), input); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, err := yandex.GenerateBranchName(context.Background(), input); err != nil || got != "generated" {
+		t.Fatalf("Unexpected result %q: %v", got, err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	if requests[0].ModelURI != "ds://tuned" || requests[0].CompletionOptions.Temperature != 0.6 || requests[0].CompletionOptions.MaxTokens != 2000 {
+		t.Errorf("Unexpected description request options: %+v", requests[0])
+	}
+	if requests[1].ModelURI != "gpt://folder/yandexgpt-lite/latest" || requests[1].CompletionOptions.MaxTokens != 100 {
+		t.Errorf("Expected default branch name options, got %+v", requests[1])
+	}
+}
+
+func TestYandexGPT_retriesOnlyRateLimits(t *testing.T) {
+	requests, status := 0, http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "overloaded", status)
+			return
+		}
+		json.NewEncoder(w).Encode(YandexGPTResponse{Result: Result{Alternatives: []Alternative{{Message: Message{Text: "Add cache"}}}}})
+	}))
+	defer server.Close()
+
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL
+	if title, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err != nil || title != "Add cache" {
+		t.Errorf("Expected success after a retry, got %q: %v", title, err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+
+	requests, status = 0, http.StatusBadGateway
+	if _, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err == nil || !strings.Contains(err.Error(), "status 502") {
+		t.Errorf("Expected the 502 to be returned, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected a completion not to be sent again after a 502, got %d requests", requests)
+	}
+}
+
+type usageRecords []Usage
+
+func (r *usageRecords) RecordUsage(usage Usage) {
+	*r = append(*r, usage)
+}
+
+func TestYandexGPT_usage(t *testing.T) {
+	status := StatusFinal
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"result": {"alternatives": [{"message": {"role": "assistant", "text": "Add cache"}, "status": %q}],
+			"usage": {"inputTextTokens": "120", "completionTokens": "8", "totalTokens": "128"}, "modelVersion": "23.10.2024"}}`, status)
+	}))
+	defer server.Close()
+
+	yandex := NewYandexGPT("key", "folder")
+	yandex.Endpoint = server.URL
+	var records usageRecords
+	yandex.SetUsageRecorder(&records)
+
+	if _, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := Usage{Kind: KindTitle, Model: "yandexgpt-lite/latest", Mode: ModeSync, InputTokens: 120, OutputTokens: 8, Status: StatusFinal}
+	if len(records) != 1 || records[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, records)
+	}
+
+	status = StatusContentFilter
+	if _, err := yandex.GeneratePRTitle(context.Background(), &Input{Diff: "diff"}); err == nil || !strings.Contains(err.Error(), "content filter") {
+		t.Errorf("Expected a filtered answer to fail, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected filtered answers to be counted too, got %d records", len(records))
+	}
+}
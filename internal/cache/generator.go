@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/deck/branchtale/internal/ai"
+)
+
+// Generator is the content generator being cached.
+type Generator interface {
+	GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error)
+	GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error)
+	GenerateBranchName(ctx context.Context, input *ai.Input) (string, error)
+	GenerateContent(ctx context.Context, input *ai.Input) (*ai.Content, error)
+	Refine(ctx context.Context, kind ai.ContentKind, input *ai.Input, history []ai.Revision) (string, error)
+}
+
+// Fingerprinter is implemented by generators whose answers depend on more
+// than the input, such as the model and the prompt template. A change of the
+// fingerprint makes earlier entries miss.
+type Fingerprinter interface {
+	Fingerprint(kind ai.ContentKind) string
+}
+
+type refreshKey struct{}
+
+// Refresh makes requests with ctx skip the cache and replace the entry, e.g.
+// when the user asks for another suggestion.
+func Refresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// CachedGenerator answers from the store when the same content was generated
+// by the same backend for the same input before. Refinements are not cached.
+type CachedGenerator struct {
+	backend string
+	next    Generator
+	store   *Store
+}
+
+func NewGenerator(backend string, next Generator, store *Store) *CachedGenerator {
+	return &CachedGenerator{backend: backend, next: next, store: store}
+}
+
+func (g *CachedGenerator) GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error) {
+	return cached(ctx, g, ai.KindTitle, input, g.next.GeneratePRTitle)
+}
+
+func (g *CachedGenerator) GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error) {
+	return cached(ctx, g, ai.KindDescription, input, g.next.GeneratePRDescription)
+}
+
+func (g *CachedGenerator) GenerateBranchName(ctx context.Context, input *ai.Input) (string, error) {
+	return cached(ctx, g, ai.KindBranchName, input, g.next.GenerateBranchName)
+}
+
+func (g *CachedGenerator) GenerateContent(ctx context.Context, input *ai.Input) (*ai.Content, error) {
+	return cached(ctx, g, ai.KindContent, input, g.next.GenerateContent)
+}
+
+func (g *CachedGenerator) Refine(ctx context.Context, kind ai.ContentKind, input *ai.Input, history []ai.Revision) (string, error) {
+	return g.next.Refine(ctx, kind, input, history)
+}
+
+// cached looks the answer up by key and stores a new one. Failing to store it
+// does not fail the generation.
+func cached[T any](ctx context.Context, g *CachedGenerator, kind ai.ContentKind, input *ai.Input, generate func(context.Context, *ai.Input) (T, error)) (T, error) {
+	key := g.key(kind, input)
+	var value T
+	if refresh, _ := ctx.Value(refreshKey{}).(bool); !refresh && g.store.Get(key, &value) {
+		return value, nil
+	}
+
+	value, err := generate(ctx, input)
+	if err != nil {
+		return value, err
+	}
+	g.store.Put(key, value)
+	return value, nil
+}
+
+// key hashes the backend, its fingerprint for kind and the input with the
+// diff normalized.
+func (g *CachedGenerator) key(kind ai.ContentKind, input *ai.Input) string {
+	fingerprint := ""
+	if f, ok := g.next.(Fingerprinter); ok {
+		fingerprint = f.Fingerprint(kind)
+	}
+	normalized := *input
+	normalized.Diff = NormalizeDiff(input.Diff)
+
+	data, _ := json.Marshal(struct {
+		Backend     string
+		Kind        ai.ContentKind
+		Fingerprint string
+		Input       ai.Input
+	}{g.backend, kind, fingerprint, normalized})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeDiff drops what changes without the change itself changing: the
+// blob hashes of index lines and line endings. Whitespace is kept, since a
+// whitespace change is a change too.
+func NormalizeDiff(diff string) string {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "index ") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+)
+
+type countingGenerator struct {
+	calls       map[ai.ContentKind]int
+	fingerprint string
+}
+
+func (g *countingGenerator) answer(kind ai.ContentKind) (string, error) {
+	g.calls[kind]++
+	return fmt.Sprintf("%s #%d", kind, g.calls[kind]), nil
+}
+
+func (g *countingGenerator) GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error) {
+	return g.answer(ai.KindTitle)
+}
+
+func (g *countingGenerator) GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error) {
+	return g.answer(ai.KindDescription)
+}
+
+func (g *countingGenerator) GenerateBranchName(ctx context.Context, input *ai.Input) (string, error) {
+	return g.answer(ai.KindBranchName)
+}
+
+func (g *countingGenerator) GenerateContent(ctx context.Context, input *ai.Input) (*ai.Content, error) {
+	title, _ := g.answer(ai.KindContent)
+	return &ai.Content{Title: title, Labels: []string{"enhancement"}}, nil
+}
+
+func (g *countingGenerator) Refine(ctx context.Context, kind ai.ContentKind, input *ai.Input, history []ai.Revision) (string, error) {
+	return g.answer("refine")
+}
+
+func (g *countingGenerator) Fingerprint(kind ai.ContentKind) string {
+	return g.fingerprint
+}
+
+func TestNormalizeDiff(t *testing.T) {
+	diff := "diff --git a/x b/x\nindex 1111111..2222222 100644\n+cache\n"
+	if got := NormalizeDiff("diff --git a/x b/x\r\nindex 3333333..4444444 100644\r\n+cache\r\n"); got != NormalizeDiff(diff) {
+		t.Errorf("Expected blob hashes and line endings to be ignored, got %q", got)
+	}
+	if got := NormalizeDiff("diff --git a/x b/x\nindex 1111111..2222222 100644\n+cache  \n"); got == NormalizeDiff(diff) {
+		t.Errorf("Expected trailing whitespace to be kept, got %q", got)
+	}
+}
+
+func TestCachedGenerator(t *testing.T) {
+	next := &countingGenerator{calls: map[ai.ContentKind]int{}, fingerprint: "yandexgpt-lite"}
+	generator := NewGenerator("yandex", next, NewStore(t.TempDir(), time.Hour, 0))
+	ctx := context.Background()
+	input := &ai.Input{Diff: "diff --git a/x b/x\nindex 1111111..2222222 100644\n+cache\n", Commits: []string{"Add cache"}}
+
+	first, _ := generator.GeneratePRTitle(ctx, input)
+	rebased := *input
+	rebased.Diff = "diff --git a/x b/x\r\nindex 3333333..4444444 100644\r\n+cache\r\n"
+	second, _ := generator.GeneratePRTitle(ctx, &rebased)
+	if first != "title #1" || second != "title #1" {
+		t.Errorf("Expected the same diff to hit the cache, got %q and %q", first, second)
+	}
+
+	if description, _ := generator.GeneratePRDescription(ctx, input); description != "description #1" {
+		t.Errorf("Expected another kind to miss, got %q", description)
+	}
+	if title, _ := generator.GeneratePRTitle(ctx, &ai.Input{Diff: input.Diff, Commits: []string{"Add cache"}, Language: "Russian"}); title != "title #2" {
+		t.Errorf("Expected another input to miss, got %q", title)
+	}
+
+	next.fingerprint = "yandexgpt-pro"
+	if title, _ := generator.GeneratePRTitle(ctx, input); title != "title #3" {
+		t.Errorf("Expected another model to miss, got %q", title)
+	}
+	if title, _ := generator.GeneratePRTitle(Refresh(ctx), input); title != "title #4" {
+		t.Errorf("Expected a refresh to skip the cache, got %q", title)
+	}
+	if title, _ := generator.GeneratePRTitle(ctx, input); title != "title #4" {
+		t.Errorf("Expected the refreshed answer to be stored, got %q", title)
+	}
+
+	for range 2 {
+		content, _ := generator.GenerateContent(ctx, input)
+		if content.Title != "content #1" || content.Labels[0] != "enhancement" {
+			t.Errorf("Expected the cached content, got %+v", content)
+		}
+	}
+	for range 2 {
+		generator.Refine(ctx, ai.KindTitle, input, nil)
+	}
+	if next.calls["refine"] != 2 {
+		t.Errorf("Expected refinements not to be cached, got %d calls", next.calls["refine"])
+	}
+}
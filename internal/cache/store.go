@@ -0,0 +1,161 @@
+// Package cache keeps generated content on disk so that running branchtale
+// again on the same changes, e.g. after a failed push, does not pay for the
+// same requests twice.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTTL     = 7 * 24 * time.Hour
+	DefaultMaxSize = 50 << 20
+)
+
+// Dir returns BRANCHTALE_CACHE_DIR or branchtale/responses in the user cache
+// directory.
+func Dir() (string, error) {
+	if dir := os.Getenv("BRANCHTALE_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(base, "branchtale", "responses"), nil
+}
+
+// Store keeps one JSON file per key. Entries older than the TTL are ignored,
+// and the oldest entries are removed once the files exceed the size cap.
+type Store struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	now     func() time.Time
+}
+
+// NewStore creates a store in dir. Zero ttl and maxSize use the defaults.
+func NewStore(dir string, ttl time.Duration, maxSize int64) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &Store{dir: dir, ttl: ttl, maxSize: maxSize, now: time.Now}
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+// Get decodes the entry for key into value and reports whether there was a
+// fresh one.
+func (s *Store) Get(key string, value any) bool {
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if s.now().Sub(info.ModTime()) > s.ttl {
+		os.Remove(path)
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, value) == nil
+}
+
+func (s *Store) Put(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "entry-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return s.prune()
+}
+
+// prune removes expired entries, then the oldest ones until the rest fit in
+// the size cap.
+func (s *Store) prune() error {
+	entries, err := s.entries()
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().After(entries[j].ModTime()) })
+
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size()
+		if size > s.maxSize || s.now().Sub(entry.ModTime()) > s.ttl {
+			if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to remove cache entry: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Clear removes every entry and returns how many there were.
+func (s *Store) Clear() (int, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+	}
+	return len(entries), nil
+}
+
+func (s *Store) entries() ([]fs.FileInfo, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	var entries []fs.FileInfo
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || !strings.HasSuffix(dirEntry.Name(), ".json") {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_getPut(t *testing.T) {
+	store := NewStore(t.TempDir(), time.Hour, 0)
+
+	var value string
+	if store.Get("key", &value) {
+		t.Error("Expected a miss in an empty store")
+	}
+	if err := store.Put("key", "Add cache"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !store.Get("key", &value) || value != "Add cache" {
+		t.Errorf("Expected the stored value, got %q", value)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if store.Get("key", &value) {
+		t.Error("Expected an expired entry to miss")
+	}
+	if _, err := os.Stat(store.path("key")); !os.IsNotExist(err) {
+		t.Error("Expected the expired entry to be removed")
+	}
+}
+
+func TestStore_sizeCap(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, time.Hour, 250)
+	value := strings.Repeat("x", 98)
+
+	for i, key := range []string{"a", "b", "c"} {
+		if err := store.Put(key, value); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		modTime := time.Now().Add(time.Duration(i-3) * time.Minute)
+		os.Chtimes(store.path(key), modTime, modTime)
+	}
+
+	var got string
+	if store.Get("a", &got) {
+		t.Error("Expected the oldest entry to be removed once over the cap")
+	}
+	if !store.Get("b", &got) || !store.Get("c", &got) {
+		t.Error("Expected the newest entries to be kept")
+	}
+}
+
+func TestStore_clear(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, 0, 0)
+	store.Put("a", "1")
+	store.Put("b", "2")
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0o600)
+
+	removed, err := store.Clear()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 removed entries, got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Error("Expected other files to be kept")
+	}
+
+	if removed, err := NewStore(filepath.Join(dir, "missing"), 0, 0).Clear(); err != nil || removed != 0 {
+		t.Errorf("Expected nothing to clear in a missing directory, got %d, %v", removed, err)
+	}
+}
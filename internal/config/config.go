@@ -1,48 +1,383 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+
+	TitleStylePlain        = "plain"
+	TitleStyleConventional = "conventional"
+
+	TrackerGitHub = "github"
+	TrackerJira   = "jira"
+
+	GeneratorLocal  = "local"
+	GeneratorYandex = "yandex"
+	GeneratorOpenAI = "openai"
+
+	DefaultTicketPattern = `\b[A-Z]{2}[A-Z0-9]*-[0-9]+\b|#[0-9]+`
+)
+
+// Languages maps the supported language codes to the names used in prompts.
+var Languages = map[string]string{
+	"en": "English",
+	"ru": "Russian",
+}
+
+// ModelOperations are the generation steps whose YandexGPT settings can be
+// configured separately with YANDEX_GPT_<OPERATION>_MODEL and friends.
+// "content" is the combined request for all of them.
+var ModelOperations = []string{"title", "description", "branch", "content"}
+
+// ModelSettings override the YandexGPT model settings. Unset fields keep the
+// defaults.
+type ModelSettings struct {
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+	Mode        string
+}
+
 type Config struct {
-	GitHubToken       string
-	YandexGPTAPIKey   string
-	YandexFolderID    string
-	BranchPrefix      string
-	Verbose           bool
-	ContentGeneration string
-	UseAI             bool
-	DryRun            bool
+	GitHubToken             string
+	YandexGPTAPIKey         string
+	YandexFolderID          string
+	YandexIAMToken          string
+	YandexKeyFile           string
+	YandexIAMEndpoint       string
+	YandexEndpoint          string
+	YandexOperationEndpoint string
+	YandexModel             ModelSettings
+	YandexModels            map[string]ModelSettings
+	YandexConcurrency       int
+	OpenAIAPIKey            string
+	OpenAIBaseURL           string
+	OpenAIModel             string
+	OpenAIConcurrency       int
+	BranchPrefix            string
+	BranchTemplate          string
+	TitleTemplate           string
+	TitleStyle              string
+	Language                string
+	TicketPattern           string
+	Tracker                 string
+	FetchIssues             bool
+	JiraURL                 string
+	JiraUser                string
+	JiraToken               string
+	Verbose                 bool
+	ContentGeneration       string
+	Generators              []string
+	SkippedGenerators       []string
+	FallbackTimeout         time.Duration
+	UseAI                   bool
+	DryRun                  bool
+	Interactive             bool
+	Output                  string
+	PlanOut                 string
+	ResetBase               bool
+	NoCache                 bool
+	CacheTTL                time.Duration
+	CacheMaxSize            int64
+	Prices                  map[string]float64
+	UsageLog                string
+	SecretStore             string
+
+	secrets SecretStore
 }
 
 func LoadEnvs() (*Config, error) {
 	cfg := &Config{
-		GitHubToken:       os.Getenv("GITHUB_TOKEN"),
-		YandexGPTAPIKey:   os.Getenv("YANDEX_GPT_API_KEY"),
-		YandexFolderID:    os.Getenv("YANDEX_FOLDER_ID"),
-		ContentGeneration: os.Getenv("CONTENT_GENERATION"),
-		UseAI:             false,
+		GitHubToken:             os.Getenv("GITHUB_TOKEN"),
+		YandexGPTAPIKey:         os.Getenv("YANDEX_GPT_API_KEY"),
+		YandexFolderID:          os.Getenv("YANDEX_FOLDER_ID"),
+		ContentGeneration:       os.Getenv("CONTENT_GENERATION"),
+		SecretStore:             os.Getenv("BRANCHTALE_SECRET_STORE"),
+		BranchTemplate:          os.Getenv("BRANCHTALE_BRANCH_TEMPLATE"),
+		TitleTemplate:           os.Getenv("BRANCHTALE_TITLE_TEMPLATE"),
+		TitleStyle:              os.Getenv("BRANCHTALE_TITLE_STYLE"),
+		Language:                os.Getenv("BRANCHTALE_LANGUAGE"),
+		TicketPattern:           os.Getenv("BRANCHTALE_TICKET_PATTERN"),
+		Tracker:                 os.Getenv("BRANCHTALE_TRACKER"),
+		FetchIssues:             os.Getenv("BRANCHTALE_FETCH_ISSUES") == "true",
+		JiraURL:                 os.Getenv("JIRA_URL"),
+		JiraUser:                os.Getenv("JIRA_USER"),
+		JiraToken:               os.Getenv("JIRA_TOKEN"),
+		YandexIAMToken:          os.Getenv("YANDEX_IAM_TOKEN"),
+		YandexKeyFile:           os.Getenv("YANDEX_SA_KEY_FILE"),
+		YandexIAMEndpoint:       os.Getenv("YANDEX_IAM_ENDPOINT"),
+		YandexEndpoint:          os.Getenv("YANDEX_GPT_ENDPOINT"),
+		YandexOperationEndpoint: os.Getenv("YANDEX_OPERATION_ENDPOINT"),
+		YandexModels:            map[string]ModelSettings{},
+		OpenAIAPIKey:            os.Getenv("OPENAI_API_KEY"),
+		OpenAIBaseURL:           os.Getenv("OPENAI_BASE_URL"),
+		OpenAIModel:             os.Getenv("OPENAI_MODEL"),
+		NoCache:                 os.Getenv("BRANCHTALE_NO_CACHE") == "true",
+		UsageLog:                os.Getenv("BRANCHTALE_USAGE_LOG"),
+		UseAI:                   false,
 	}
 
-	if cfg.GitHubToken == "" {
-		return nil, fmt.Errorf("GITHUB_TOKEN environment variable is required")
+	if value := os.Getenv("BRANCHTALE_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("BRANCHTALE_CACHE_TTL must be a positive duration such as 24h, got %q", value)
+		}
+		cfg.CacheTTL = ttl
+	}
+	if value := os.Getenv("BRANCHTALE_FALLBACK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("BRANCHTALE_FALLBACK_TIMEOUT must be a positive duration such as 90s, got %q", value)
+		}
+		cfg.FallbackTimeout = timeout
+	}
+	if value := os.Getenv("BRANCHTALE_CACHE_MAX_MB"); value != "" {
+		megabytes, err := strconv.Atoi(value)
+		if err != nil || megabytes <= 0 {
+			return nil, fmt.Errorf("BRANCHTALE_CACHE_MAX_MB must be a positive number, got %q", value)
+		}
+		cfg.CacheMaxSize = int64(megabytes) << 20
+	}
+	if value := os.Getenv("BRANCHTALE_PRICES"); value != "" {
+		prices, err := parsePrices(value)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Prices = prices
+	}
+	if value := os.Getenv("YANDEX_GPT_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil || concurrency <= 0 {
+			return nil, fmt.Errorf("YANDEX_GPT_CONCURRENCY must be a positive number, got %q", value)
+		}
+		cfg.YandexConcurrency = concurrency
+	}
+	if value := os.Getenv("OPENAI_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil || concurrency <= 0 {
+			return nil, fmt.Errorf("OPENAI_CONCURRENCY must be a positive number, got %q", value)
+		}
+		cfg.OpenAIConcurrency = concurrency
+	}
+
+	var err error
+	if cfg.YandexModel, err = loadModelSettings("YANDEX_GPT_"); err != nil {
+		return nil, err
+	}
+	for _, operation := range ModelOperations {
+		if cfg.YandexModels[operation], err = loadModelSettings("YANDEX_GPT_" + strings.ToUpper(operation) + "_"); err != nil {
+			return nil, err
+		}
 	}
 
 	return cfg, nil
 }
 
+func loadModelSettings(prefix string) (ModelSettings, error) {
+	settings := ModelSettings{Model: os.Getenv(prefix + "MODEL"), Mode: os.Getenv(prefix + "MODE")}
+	switch settings.Mode {
+	case "", "sync", "async", "stream":
+	default:
+		return settings, fmt.Errorf("%sMODE must be 'sync', 'async' or 'stream', got %q", prefix, settings.Mode)
+	}
+	if value := os.Getenv(prefix + "TEMPERATURE"); value != "" {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 1 {
+			return settings, fmt.Errorf("%sTEMPERATURE must be a number between 0 and 1, got %q", prefix, value)
+		}
+		settings.Temperature = &temperature
+	}
+	if value := os.Getenv(prefix + "MAX_TOKENS"); value != "" {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens <= 0 {
+			return settings, fmt.Errorf("%sMAX_TOKENS must be a positive number, got %q", prefix, value)
+		}
+		settings.MaxTokens = maxTokens
+	}
+	return settings, nil
+}
+
+// parsePrices reads comma-separated model=price pairs, the price being per
+// 1000 tokens.
+func parsePrices(value string) (map[string]float64, error) {
+	prices := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		model, priceText, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		price, err := strconv.ParseFloat(strings.TrimSpace(priceText), 64)
+		if !ok || strings.TrimSpace(model) == "" || err != nil || price < 0 {
+			return nil, fmt.Errorf("BRANCHTALE_PRICES must be comma-separated model=price pairs, got %q", pair)
+		}
+		prices[strings.TrimSpace(model)] = price
+	}
+	return prices, nil
+}
+
 func (cfg *Config) Finalize() error {
-	if cfg.ContentGeneration != "" && cfg.ContentGeneration != "local" {
-		if cfg.YandexGPTAPIKey == "" {
-			return fmt.Errorf("YANDEX_GPT_API_KEY environment variable is required")
+	switch cfg.Output {
+	case "":
+		cfg.Output = OutputText
+	case OutputText, OutputJSON:
+	default:
+		return fmt.Errorf("unknown output format %q (expected 'text' or 'json')", cfg.Output)
+	}
+
+	if cfg.BranchTemplate == "" {
+		cfg.BranchTemplate = "{slug}"
+	}
+	if !strings.Contains(cfg.BranchTemplate, "{slug}") {
+		return fmt.Errorf("branch template %q must contain {slug}", cfg.BranchTemplate)
+	}
+
+	if cfg.TitleTemplate == "" {
+		cfg.TitleTemplate = "{title}"
+	}
+	if !strings.Contains(cfg.TitleTemplate, "{title}") {
+		return fmt.Errorf("title template %q must contain {title}", cfg.TitleTemplate)
+	}
+	switch cfg.TitleStyle {
+	case "":
+		cfg.TitleStyle = TitleStylePlain
+	case TitleStylePlain, TitleStyleConventional:
+	default:
+		return fmt.Errorf("unknown title style %q (expected 'plain' or 'conventional')", cfg.TitleStyle)
+	}
+	if err := cfg.SetLanguage(cfg.Language); err != nil {
+		return err
+	}
+	if cfg.TicketPattern == "" {
+		cfg.TicketPattern = DefaultTicketPattern
+	}
+	if _, err := regexp.Compile(cfg.TicketPattern); err != nil {
+		return fmt.Errorf("invalid ticket pattern: %w", err)
+	}
+	switch cfg.Tracker {
+	case "", TrackerGitHub:
+	case TrackerJira:
+		if cfg.JiraURL == "" {
+			return fmt.Errorf("JIRA_URL environment variable is required for the jira tracker")
+		}
+	default:
+		return fmt.Errorf("unknown tracker %q (expected 'github' or 'jira')", cfg.Tracker)
+	}
+
+	// ContentGeneration lists the backends in the order they are tried,
+	// e.g. "yandex,openai,local". Only the first one must be configured: a
+	// later one without credentials is left out of the chain and reported in
+	// SkippedGenerators.
+	cfg.Generators, cfg.SkippedGenerators = nil, nil
+	cfg.UseAI = false
+	var listed []string
+	for _, backend := range strings.Split(cfg.ContentGeneration, ",") {
+		backend = strings.TrimSpace(backend)
+		if backend == "" {
+			continue
+		}
+		if slices.Contains(listed, backend) {
+			return fmt.Errorf("content generation backend %q is listed twice", backend)
+		}
+		listed = append(listed, backend)
+		if !slices.Contains([]string{GeneratorLocal, GeneratorYandex, GeneratorOpenAI}, backend) {
+			return fmt.Errorf("unknown content generation mode %q (expected 'local', 'yandex' or 'openai')", backend)
+		}
+		if err := cfg.requireGenerator(backend); err != nil {
+			if len(listed) == 1 {
+				return err
+			}
+			cfg.SkippedGenerators = append(cfg.SkippedGenerators, fmt.Sprintf("%s: %v", backend, err))
+			continue
+		}
+		cfg.Generators = append(cfg.Generators, backend)
+		cfg.UseAI = cfg.UseAI || backend != GeneratorLocal
+	}
+	if len(cfg.Generators) == 0 {
+		cfg.Generators = []string{GeneratorLocal}
+	}
+	return nil
+}
+
+// requireGenerator checks that the credentials of a content generation
+// backend are set.
+func (cfg *Config) requireGenerator(backend string) error {
+	switch backend {
+	case GeneratorLocal:
+	case GeneratorYandex:
+		// An IAM token or a service account key replaces the API key.
+		if cfg.YandexIAMToken == "" && cfg.YandexKeyFile == "" {
+			if err := cfg.loadSecret(&cfg.YandexGPTAPIKey, SecretYandexGPTAPIKey); err != nil {
+				return err
+			}
+			if cfg.YandexGPTAPIKey == "" {
+				return fmt.Errorf("YANDEX_GPT_API_KEY environment variable is required")
+			}
 		}
 		if cfg.YandexFolderID == "" {
 			return fmt.Errorf("YANDEX_FOLDER_ID environment variable is required")
 		}
-		cfg.UseAI = true
-	} else {
-		cfg.UseAI = false
+	case GeneratorOpenAI:
+		if err := cfg.loadSecret(&cfg.OpenAIAPIKey, SecretOpenAIAPIKey); err != nil {
+			return err
+		}
+		// Self-hosted servers behind OPENAI_BASE_URL often need no key.
+		if cfg.OpenAIAPIKey == "" && cfg.OpenAIBaseURL == "" {
+			return fmt.Errorf("OPENAI_API_KEY environment variable is required")
+		}
+	}
+	return nil
+}
+
+// SetLanguage validates and sets the language code. It is also used for the
+// per-repository setting, which is only read once the repository is known.
+func (cfg *Config) SetLanguage(language string) error {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if _, ok := Languages[language]; language != "" && !ok {
+		return fmt.Errorf("unknown language %q (expected 'en' or 'ru')", language)
+	}
+	cfg.Language = language
+	return nil
+}
+
+// RequireGitHubToken is called right before the first GitHub API call, so
+// dry runs and content-only runs work without a token.
+func (cfg *Config) RequireGitHubToken() error {
+	if err := cfg.loadSecret(&cfg.GitHubToken, SecretGitHubToken); err != nil {
+		return err
+	}
+	if cfg.GitHubToken == "" {
+		return fmt.Errorf("GITHUB_TOKEN environment variable is required")
+	}
+	return nil
+}
+
+func (cfg *Config) loadSecret(field *string, key string) error {
+	if *field != "" {
+		return nil
+	}
+
+	if cfg.secrets == nil {
+		store, err := NewSecretStore(cfg.SecretStore)
+		if err != nil {
+			return err
+		}
+		cfg.secrets = store
+	}
+
+	value, err := cfg.secrets.Get(key)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s from %s secret store: %w", key, cfg.secrets.Name(), err)
 	}
+	*field = value
 	return nil
 }
@@ -2,10 +2,15 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadEnvsAndFinalize(t *testing.T) {
+	t.Setenv("BRANCHTALE_CONFIG_DIR", t.TempDir())
+	t.Setenv("BRANCHTALE_SECRET_STORE", "file")
+
 	// Save original env vars
 	originalGitHubToken := os.Getenv("GITHUB_TOKEN")
 	originalYandexAPIKey := os.Getenv("YANDEX_GPT_API_KEY")
@@ -95,7 +100,14 @@ func TestLoadEnvsAndFinalize(t *testing.T) {
 		os.Setenv("YANDEX_FOLDER_ID", "test-folder-id")
 		os.Setenv("CONTENT_GENERATION", "yandex")
 
-		_, err := LoadEnvs()
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := cfg.Finalize(); err != nil {
+			t.Fatalf("expected no error from Finalize, got %v", err)
+		}
+		err = cfg.RequireGitHubToken()
 		if err == nil {
 			t.Fatal("expected error for missing GITHUB_TOKEN")
 		}
@@ -125,6 +137,24 @@ func TestLoadEnvsAndFinalize(t *testing.T) {
 		}
 	})
 
+	t.Run("IAM token or service account key instead of YANDEX_GPT_API_KEY", func(t *testing.T) {
+		os.Unsetenv("YANDEX_GPT_API_KEY")
+		os.Setenv("YANDEX_FOLDER_ID", "test-folder-id")
+		os.Setenv("CONTENT_GENERATION", "yandex")
+
+		for _, env := range []string{"YANDEX_IAM_TOKEN", "YANDEX_SA_KEY_FILE"} {
+			t.Setenv(env, "value")
+			cfg, err := LoadEnvs()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := cfg.Finalize(); err != nil {
+				t.Errorf("expected %s to be enough, got %v", env, err)
+			}
+			os.Unsetenv(env)
+		}
+	})
+
 	t.Run("missing YANDEX_FOLDER_ID", func(t *testing.T) {
 		os.Setenv("GITHUB_TOKEN", "test-github-token")
 		os.Setenv("YANDEX_GPT_API_KEY", "test-yandex-key")
@@ -144,4 +174,255 @@ func TestLoadEnvsAndFinalize(t *testing.T) {
 			t.Errorf("expected error '%s', got '%s'", expected, err.Error())
 		}
 	})
+
+	t.Run("local mode does not need AI credentials", func(t *testing.T) {
+		os.Unsetenv("GITHUB_TOKEN")
+		os.Unsetenv("YANDEX_GPT_API_KEY")
+		os.Unsetenv("YANDEX_FOLDER_ID")
+
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cfg.ContentGeneration = "local"
+		if err := cfg.Finalize(); err != nil {
+			t.Fatalf("expected no error from Finalize, got %v", err)
+		}
+	})
+
+	t.Run("unknown content generation mode", func(t *testing.T) {
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cfg.ContentGeneration = "gpt-9000"
+		if err := cfg.Finalize(); err == nil {
+			t.Fatal("expected error for unknown content generation mode")
+		}
+	})
+
+	t.Run("branch template", func(t *testing.T) {
+		t.Setenv("BRANCHTALE_BRANCH_TEMPLATE", "{type}/{ticket}-{slug}")
+
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cfg.ContentGeneration = "local"
+		if err := cfg.Finalize(); err != nil {
+			t.Fatalf("expected no error from Finalize, got %v", err)
+		}
+		if cfg.BranchTemplate != "{type}/{ticket}-{slug}" {
+			t.Errorf("expected branch template from env, got '%s'", cfg.BranchTemplate)
+		}
+
+		cfg.BranchTemplate = "{type}/{ticket}"
+		if err := cfg.Finalize(); err == nil {
+			t.Fatal("expected error for template without {slug}")
+		}
+	})
+
+	t.Run("ticket and title settings", func(t *testing.T) {
+		t.Setenv("BRANCHTALE_TRACKER", "jira")
+		t.Setenv("BRANCHTALE_FETCH_ISSUES", "true")
+		t.Setenv("JIRA_URL", "")
+
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cfg.ContentGeneration = "local"
+		if !cfg.FetchIssues {
+			t.Error("expected FetchIssues from env")
+		}
+		if err := cfg.Finalize(); err == nil {
+			t.Fatal("expected error for jira tracker without JIRA_URL")
+		}
+
+		cfg.JiraURL = "https://jira.example.com"
+		if err := cfg.Finalize(); err != nil {
+			t.Fatalf("expected no error from Finalize, got %v", err)
+		}
+		if cfg.TitleTemplate != "{title}" || cfg.TicketPattern != DefaultTicketPattern {
+			t.Errorf("expected default title template and ticket pattern, got '%s' and '%s'", cfg.TitleTemplate, cfg.TicketPattern)
+		}
+
+		if cfg.TitleStyle != TitleStylePlain {
+			t.Errorf("expected plain title style by default, got '%s'", cfg.TitleStyle)
+		}
+		cfg.TitleStyle = "fancy"
+		if err := cfg.Finalize(); err == nil {
+			t.Error("expected error for unknown title style")
+		}
+		cfg.TitleStyle = TitleStyleConventional
+
+		cfg.Language = "RU"
+		if err := cfg.Finalize(); err != nil || cfg.Language != "ru" {
+			t.Errorf("expected language code to be normalized, got '%s' (%v)", cfg.Language, err)
+		}
+		cfg.Language = "klingon"
+		if err := cfg.Finalize(); err == nil {
+			t.Error("expected error for unknown language")
+		}
+		cfg.Language = ""
+
+		cfg.TicketPattern = "([A-Z"
+		if err := cfg.Finalize(); err == nil {
+			t.Error("expected error for invalid ticket pattern")
+		}
+		cfg.TicketPattern = ""
+		cfg.Tracker = "redmine"
+		if err := cfg.Finalize(); err == nil {
+			t.Error("expected error for unknown tracker")
+		}
+	})
+
+	t.Run("yandex model settings", func(t *testing.T) {
+		t.Setenv("YANDEX_GPT_MODEL", "yandexgpt/rc")
+		t.Setenv("YANDEX_GPT_DESCRIPTION_MAX_TOKENS", "2000")
+		t.Setenv("YANDEX_GPT_BRANCH_TEMPERATURE", "0")
+		t.Setenv("YANDEX_GPT_DESCRIPTION_MODE", "stream")
+
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.YandexModel.Model != "yandexgpt/rc" || cfg.YandexModel.Temperature != nil {
+			t.Errorf("unexpected default model settings: %+v", cfg.YandexModel)
+		}
+		if cfg.YandexModels["description"].MaxTokens != 2000 {
+			t.Errorf("expected description max tokens 2000, got %d", cfg.YandexModels["description"].MaxTokens)
+		}
+		if cfg.YandexModels["description"].Mode != "stream" {
+			t.Errorf("expected description mode stream, got '%s'", cfg.YandexModels["description"].Mode)
+		}
+		if temperature := cfg.YandexModels["branch"].Temperature; temperature == nil || *temperature != 0 {
+			t.Errorf("expected branch temperature 0, got %v", temperature)
+		}
+
+		t.Setenv("YANDEX_GPT_MODE", "batch")
+		if _, err := LoadEnvs(); err == nil {
+			t.Error("expected error for unknown mode")
+		}
+		t.Setenv("YANDEX_GPT_MODE", "")
+
+		t.Setenv("YANDEX_GPT_TITLE_TEMPERATURE", "1.5")
+		if _, err := LoadEnvs(); err == nil {
+			t.Error("expected error for temperature out of range")
+		}
+	})
+
+	t.Run("yandex concurrency", func(t *testing.T) {
+		t.Setenv("YANDEX_GPT_CONCURRENCY", "2")
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.YandexConcurrency != 2 {
+			t.Errorf("expected concurrency 2, got %d", cfg.YandexConcurrency)
+		}
+
+		t.Setenv("YANDEX_GPT_CONCURRENCY", "0")
+		if _, err := LoadEnvs(); err == nil {
+			t.Error("expected error for concurrency 0")
+		}
+	})
+
+	t.Run("openai concurrency", func(t *testing.T) {
+		t.Setenv("OPENAI_CONCURRENCY", "5")
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.OpenAIConcurrency != 5 {
+			t.Errorf("expected concurrency 5, got %d", cfg.OpenAIConcurrency)
+		}
+
+		t.Setenv("OPENAI_CONCURRENCY", "many")
+		if _, err := LoadEnvs(); err == nil {
+			t.Error("expected error for a concurrency that is not a number")
+		}
+	})
+
+	t.Run("cache settings", func(t *testing.T) {
+		t.Setenv("BRANCHTALE_NO_CACHE", "true")
+		t.Setenv("BRANCHTALE_CACHE_TTL", "24h")
+		t.Setenv("BRANCHTALE_CACHE_MAX_MB", "10")
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !cfg.NoCache || cfg.CacheTTL != 24*time.Hour || cfg.CacheMaxSize != 10<<20 {
+			t.Errorf("unexpected cache settings: %v, %s, %d", cfg.NoCache, cfg.CacheTTL, cfg.CacheMaxSize)
+		}
+
+		t.Setenv("BRANCHTALE_CACHE_TTL", "a day")
+		if _, err := LoadEnvs(); err == nil {
+			t.Error("expected error for invalid TTL")
+		}
+	})
+
+	t.Run("prices", func(t *testing.T) {
+		t.Setenv("BRANCHTALE_PRICES", "yandexgpt=1.5, yandexgpt:async=0.75")
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.Prices["yandexgpt"] != 1.5 || cfg.Prices["yandexgpt:async"] != 0.75 {
+			t.Errorf("unexpected prices: %v", cfg.Prices)
+		}
+
+		t.Setenv("BRANCHTALE_PRICES", "yandexgpt")
+		if _, err := LoadEnvs(); err == nil {
+			t.Error("expected error for a price without a value")
+		}
+	})
+
+	t.Run("fallback chain", func(t *testing.T) {
+		t.Setenv("YANDEX_GPT_API_KEY", "test-yandex-key")
+		t.Setenv("YANDEX_FOLDER_ID", "test-folder-id")
+		t.Setenv("OPENAI_API_KEY", "")
+		t.Setenv("OPENAI_BASE_URL", "")
+		t.Setenv("BRANCHTALE_FALLBACK_TIMEOUT", "30s")
+		cfg, err := LoadEnvs()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.FallbackTimeout != 30*time.Second {
+			t.Errorf("expected fallback timeout from env, got %s", cfg.FallbackTimeout)
+		}
+
+		cfg.ContentGeneration = "yandex, openai, local"
+		if err := cfg.Finalize(); err != nil {
+			t.Fatalf("expected a backend without credentials to be skipped, got %v", err)
+		}
+		if strings.Join(cfg.Generators, ",") != "yandex,local" || len(cfg.SkippedGenerators) != 1 || cfg.SkippedGenerators[0] != "openai: OPENAI_API_KEY environment variable is required" {
+			t.Errorf("unexpected generators: %v (skipped %v)", cfg.Generators, cfg.SkippedGenerators)
+		}
+		cfg.ContentGeneration = "openai,local"
+		if err := cfg.Finalize(); err == nil || err.Error() != "OPENAI_API_KEY environment variable is required" {
+			t.Errorf("expected error for missing OPENAI_API_KEY on the first backend, got %v", err)
+		}
+		cfg.ContentGeneration = "yandex,gemini"
+		if err := cfg.Finalize(); err == nil || !strings.Contains(err.Error(), "unknown content generation mode") {
+			t.Errorf("expected error for an unknown backend, got %v", err)
+		}
+		cfg.ContentGeneration = "yandex, openai, local"
+		cfg.OpenAIBaseURL = "http://localhost:11434/v1"
+		if err := cfg.Finalize(); err != nil {
+			t.Fatalf("expected no error from Finalize, got %v", err)
+		}
+		if strings.Join(cfg.Generators, ",") != "yandex,openai,local" || !cfg.UseAI {
+			t.Errorf("unexpected generators: %v (UseAI %v)", cfg.Generators, cfg.UseAI)
+		}
+
+		cfg.ContentGeneration = "yandex,yandex"
+		if err := cfg.Finalize(); err == nil {
+			t.Error("expected error for a backend listed twice")
+		}
+		cfg.ContentGeneration = ""
+		if err := cfg.Finalize(); err != nil || strings.Join(cfg.Generators, ",") != "local" || cfg.UseAI {
+			t.Errorf("expected local generation by default, got %v (%v)", cfg.Generators, err)
+		}
+	})
 }
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SecretGitHubToken     = "github-token"
+	SecretYandexGPTAPIKey = "yandex-gpt-api-key"
+	SecretOpenAIAPIKey    = "openai-api-key"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+type Secret struct {
+	Name        string
+	Key         string
+	EnvVar      string
+	Description string
+	Host        string
+}
+
+var Secrets = []Secret{
+	{Name: "github", Key: SecretGitHubToken, EnvVar: "GITHUB_TOKEN", Description: "GitHub token", Host: "github.com"},
+	{Name: "yandex", Key: SecretYandexGPTAPIKey, EnvVar: "YANDEX_GPT_API_KEY", Description: "YandexGPT API key", Host: "llm.api.cloud.yandex.net"},
+	{Name: "openai", Key: SecretOpenAIAPIKey, EnvVar: "OPENAI_API_KEY", Description: "OpenAI-compatible API key", Host: "api.openai.com"},
+}
+
+func LookupSecret(name string) (Secret, error) {
+	for _, s := range Secrets {
+		if s.Name == name || s.Key == name {
+			return s, nil
+		}
+	}
+	return Secret{}, fmt.Errorf("unknown secret %q", name)
+}
+
+type SecretStore interface {
+	Name() string
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+func NewSecretStore(backend string) (SecretStore, error) {
+	switch backend {
+	case "", "file":
+		dir, err := Dir()
+		if err != nil {
+			return nil, err
+		}
+		return NewFileSecretStore(dir), nil
+	case "git":
+		return NewGitCredentialStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown secret store %q (expected 'file' or 'git')", backend)
+	}
+}
+
+func Dir() (string, error) {
+	if dir := os.Getenv("BRANCHTALE_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(base, "branchtale"), nil
+}
+
+// FileSecretStore keeps secrets AES-GCM encrypted in credentials.enc. The key
+// lives next to it in credentials.key, so the file is safe from casual reads
+// and accidental commits, not from someone with access to the whole directory.
+type FileSecretStore struct {
+	dir string
+}
+
+func NewFileSecretStore(dir string) *FileSecretStore {
+	return &FileSecretStore{dir: dir}
+}
+
+func (f *FileSecretStore) Name() string {
+	return "file"
+}
+
+func (f *FileSecretStore) Get(key string) (string, error) {
+	secrets, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (f *FileSecretStore) Set(key, value string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets[key] = value
+	return f.save(secrets)
+}
+
+func (f *FileSecretStore) Delete(key string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[key]; !ok {
+		return ErrSecretNotFound
+	}
+	delete(secrets, key)
+	return f.save(secrets)
+}
+
+func (f *FileSecretStore) dataPath() string {
+	return filepath.Join(f.dir, "credentials.enc")
+}
+
+func (f *FileSecretStore) keyPath() string {
+	return filepath.Join(f.dir, "credentials.key")
+}
+
+func (f *FileSecretStore) load() (map[string]string, error) {
+	secrets := map[string]string{}
+
+	data, err := os.ReadFile(f.dataPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	key, err := os.ReadFile(f.keyPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("credentials file is corrupted")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	return secrets, nil
+}
+
+func (f *FileSecretStore) save(secrets map[string]string) error {
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	key, err := f.loadOrCreateKey()
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return writeFileAtomic(f.dataPath(), gcm.Seal(nonce, nonce, plaintext, nil), 0o600)
+}
+
+func (f *FileSecretStore) loadOrCreateKey() ([]byte, error) {
+	key, err := os.ReadFile(f.keyPath())
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read credentials key: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate credentials key: %w", err)
+	}
+	if err := writeFileAtomic(f.keyPath(), key, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials key: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cipher: %w", err)
+	}
+	return gcm, nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// GitCredentialStore talks to whatever credential helper git is configured
+// with (osxkeychain, libsecret, manager, ...) via `git credential`.
+type GitCredentialStore struct {
+	run func(args []string, input string) (string, error)
+}
+
+func NewGitCredentialStore() *GitCredentialStore {
+	return &GitCredentialStore{run: runGitCredential}
+}
+
+func (g *GitCredentialStore) Name() string {
+	return "git"
+}
+
+func (g *GitCredentialStore) Get(key string) (string, error) {
+	secret, err := LookupSecret(key)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := g.run([]string{"credential", "fill"}, credentialInput(secret, ""))
+	if err != nil {
+		// git exits non-zero when no helper has the credential and prompting is disabled.
+		return "", ErrSecretNotFound
+	}
+
+	// A helper that ignores the username may still answer with the user's own
+	// login for the host, which is not ours to use.
+	fields := parseCredentialOutput(output)
+	if fields["password"] == "" || fields["username"] != credentialUsername {
+		return "", ErrSecretNotFound
+	}
+	return fields["password"], nil
+}
+
+func (g *GitCredentialStore) Set(key, value string) error {
+	secret, err := LookupSecret(key)
+	if err != nil {
+		return err
+	}
+	if _, err := g.run([]string{"credential", "approve"}, credentialInput(secret, value)); err != nil {
+		return fmt.Errorf("failed to store credential: %w", err)
+	}
+	return nil
+}
+
+func (g *GitCredentialStore) Delete(key string) error {
+	secret, err := LookupSecret(key)
+	if err != nil {
+		return err
+	}
+	value, err := g.Get(key)
+	if err != nil {
+		return err
+	}
+	if _, err := g.run([]string{"credential", "reject"}, credentialInput(secret, value)); err != nil {
+		return fmt.Errorf("failed to remove credential: %w", err)
+	}
+	return nil
+}
+
+// credentialUsername keeps branchtale's secrets apart from the user's own
+// credentials for the same host, in fill, approve and reject alike.
+const credentialUsername = "branchtale"
+
+func credentialInput(secret Secret, password string) string {
+	var b strings.Builder
+	b.WriteString("protocol=https\n")
+	fmt.Fprintf(&b, "host=%s\n", secret.Host)
+	fmt.Fprintf(&b, "username=%s\n", credentialUsername)
+	if password != "" {
+		fmt.Fprintf(&b, "password=%s\n", password)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func parseCredentialOutput(output string) map[string]string {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+func runGitCredential(args []string, input string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSecretStore_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileSecretStore(dir)
+
+	if _, err := store.Get(SecretGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("expected ErrSecretNotFound on empty store, got %v", err)
+	}
+
+	if err := store.Set(SecretGitHubToken, "ghp_secret"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	value, err := NewFileSecretStore(dir).Get(SecretGitHubToken)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value != "ghp_secret" {
+		t.Errorf("expected 'ghp_secret', got '%s'", value)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "credentials.enc"))
+	if err != nil {
+		t.Fatalf("expected credentials file, got %v", err)
+	}
+	if strings.Contains(string(data), "ghp_secret") {
+		t.Error("expected credentials file to be encrypted")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "credentials.key"))
+	if err != nil {
+		t.Fatalf("expected key file, got %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	if err := store.Delete(SecretGitHubToken); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := store.Get(SecretGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(SecretGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound deleting missing secret, got %v", err)
+	}
+}
+
+func TestGitCredentialStore(t *testing.T) {
+	var calls []string
+	var inputs []string
+	store := &GitCredentialStore{
+		run: func(args []string, input string) (string, error) {
+			calls = append(calls, strings.Join(args, " "))
+			inputs = append(inputs, input)
+			if args[1] == "fill" {
+				return "protocol=https\nhost=github.com\nusername=branchtale\npassword=ghp_from_helper\n", nil
+			}
+			return "", nil
+		},
+	}
+
+	value, err := store.Get(SecretGitHubToken)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value != "ghp_from_helper" {
+		t.Errorf("expected 'ghp_from_helper', got '%s'", value)
+	}
+	if inputs[0] != "protocol=https\nhost=github.com\nusername=branchtale\n\n" {
+		t.Errorf("unexpected fill input: %q", inputs[0])
+	}
+
+	if err := store.Set(SecretYandexGPTAPIKey, "yc-key"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls[1] != "credential approve" {
+		t.Errorf("expected 'credential approve', got '%s'", calls[1])
+	}
+	if !strings.Contains(inputs[1], "host=llm.api.cloud.yandex.net\n") || !strings.Contains(inputs[1], "password=yc-key\n") {
+		t.Errorf("unexpected approve input: %q", inputs[1])
+	}
+}
+
+// credentialHelper is a fake helper keyed by host and username. Like real
+// helpers, it answers a fill without a username with any login for the host.
+type credentialHelper map[string]string
+
+func (h credentialHelper) run(args []string, input string) (string, error) {
+	fields := parseCredentialOutput(input)
+	key := fields["host"] + "/" + fields["username"]
+	switch args[1] {
+	case "fill":
+		for stored, password := range h {
+			host, username, _ := strings.Cut(stored, "/")
+			if host == fields["host"] && (fields["username"] == "" || username == fields["username"]) {
+				return fmt.Sprintf("host=%s\nusername=%s\npassword=%s\n", host, username, password), nil
+			}
+		}
+		return "", errors.New("terminal prompts disabled")
+	case "approve":
+		h[key] = fields["password"]
+	case "reject":
+		delete(h, key)
+	}
+	return "", nil
+}
+
+func TestGitCredentialStore_keepsUserCredentials(t *testing.T) {
+	helper := credentialHelper{"github.com/octocat": "user-password"}
+	store := &GitCredentialStore{run: helper.run}
+
+	if _, err := store.Get(SecretGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected the user's own login to be ignored, got %v", err)
+	}
+	if err := store.Delete(SecretGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected nothing to delete, got %v", err)
+	}
+
+	if err := store.Set(SecretGitHubToken, "ghp_branchtale"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value, err := store.Get(SecretGitHubToken); err != nil || value != "ghp_branchtale" {
+		t.Errorf("expected the stored token, got %q (%v)", value, err)
+	}
+	if err := store.Delete(SecretGitHubToken); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if helper["github.com/octocat"] != "user-password" || len(helper) != 1 {
+		t.Errorf("expected only branchtale's credential to be removed, got %v", helper)
+	}
+}
+
+func TestGitCredentialStore_NotFound(t *testing.T) {
+	store := &GitCredentialStore{
+		run: func(args []string, input string) (string, error) {
+			return "", errors.New("terminal prompts disabled")
+		},
+	}
+	if _, err := store.Get(SecretGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestLoadEnvs_SecretStoreFallback(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("BRANCHTALE_CONFIG_DIR", dir)
+	t.Setenv("BRANCHTALE_SECRET_STORE", "file")
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("YANDEX_GPT_API_KEY", "env-yandex-key")
+
+	store := NewFileSecretStore(dir)
+	if err := store.Set(SecretGitHubToken, "stored-github-token"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.Set(SecretYandexGPTAPIKey, "stored-yandex-key"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Setenv("YANDEX_FOLDER_ID", "folder")
+	t.Setenv("CONTENT_GENERATION", "yandex")
+
+	cfg, err := LoadEnvs()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.GitHubToken != "" {
+		t.Errorf("expected GitHubToken to be loaded lazily, got '%s'", cfg.GitHubToken)
+	}
+	if err := cfg.Finalize(); err != nil {
+		t.Fatalf("expected no error from Finalize, got %v", err)
+	}
+	if err := cfg.RequireGitHubToken(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.GitHubToken != "stored-github-token" {
+		t.Errorf("expected GitHubToken from store, got '%s'", cfg.GitHubToken)
+	}
+	if cfg.YandexGPTAPIKey != "env-yandex-key" {
+		t.Errorf("expected environment to win over store, got '%s'", cfg.YandexGPTAPIKey)
+	}
+}
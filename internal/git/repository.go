@@ -3,6 +3,9 @@ package git
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
@@ -13,6 +16,7 @@ import (
 
 type Repository struct {
 	repo   *git.Repository
+	path   string
 	dryRun bool
 }
 
@@ -24,16 +28,79 @@ type RepoInfo struct {
 
 type DiffInfo struct {
 	Diff    string
+	Files   []string
 	Commits []*object.Commit
 }
 
+type CommitChanges struct {
+	Files []string
+	Patch string
+}
+
+// CherryPickConflictError reports the commit a cherry-pick stopped at and
+// the files that conflicted.
+type CherryPickConflictError struct {
+	Branch string
+	Commit string
+	Files  []string
+}
+
+func (e *CherryPickConflictError) Error() string {
+	return fmt.Sprintf("cherry-picking %s onto %s conflicts in %s", e.Commit, e.Branch, strings.Join(e.Files, ", "))
+}
+
 func NewRepository(repoPath string, dryRun bool) (*Repository, error) {
 	repo, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open git repository: %w", err)
 	}
 
-	return &Repository{repo: repo, dryRun: dryRun}, nil
+	return &Repository{repo: repo, path: repoPath, dryRun: dryRun}, nil
+}
+
+func FindRepository(startPath string) (string, error) {
+	currentPath := startPath
+	for {
+		gitPath := filepath.Join(currentPath, ".git")
+		if _, err := os.Stat(gitPath); err == nil {
+			return currentPath, nil
+		}
+
+		parent := filepath.Dir(currentPath)
+		if parent == currentPath {
+			break
+		}
+		currentPath = parent
+	}
+
+	return "", fmt.Errorf("not a git repository (or any of the parent directories)")
+}
+
+// GitDir resolves the .git directory of a work tree, following the
+// "gitdir:" pointer file used by linked worktrees and submodules.
+func GitDir(repoPath string) (string, error) {
+	gitPath := filepath.Join(repoPath, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat .git: %w", err)
+	}
+	if info.IsDir() {
+		return gitPath, nil
+	}
+
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read .git file: %w", err)
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("invalid .git file in %s", repoPath)
+	}
+	dir = strings.TrimSpace(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repoPath, dir)
+	}
+	return dir, nil
 }
 
 func (s *Repository) GetInfo() (*RepoInfo, error) {
@@ -90,6 +157,16 @@ func (s *Repository) GetRemoteUrl(ctx context.Context, name string) (string, err
 	return "", nil
 }
 
+// ConfigValue reads section.key from the repository's git config, falling
+// back to the global one, e.g. ConfigValue("branchtale", "language").
+func (s *Repository) ConfigValue(section, key string) (string, error) {
+	cfg, err := s.repo.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return "", fmt.Errorf("failed to read git config: %w", err)
+	}
+	return cfg.Raw.Section(section).Option(key), nil
+}
+
 func (s *Repository) GetDiffBetweenBranches(ctx context.Context, remote, remoteBranch, localBranch string) (*DiffInfo, error) {
 	localRef, err := s.repo.Reference(plumbing.NewBranchReferenceName(localBranch), true)
 	if err != nil {
@@ -131,8 +208,19 @@ func (s *Repository) GetDiffBetweenBranches(ctx context.Context, remote, remoteB
 		return nil, fmt.Errorf("failed to get commits: %w", err)
 	}
 
+	var files []string
+	for _, filePatch := range patch.FilePatches() {
+		from, to := filePatch.Files()
+		if to != nil {
+			files = append(files, to.Path())
+		} else if from != nil {
+			files = append(files, from.Path())
+		}
+	}
+
 	return &DiffInfo{
 		Diff:    patch.String(),
+		Files:   files,
 		Commits: commits,
 	}, nil
 }
@@ -192,7 +280,7 @@ func (s *Repository) BranchExistsOnRemote(ctx context.Context, branchName, remot
 		return false, fmt.Errorf("failed to load ssh key: %w", err)
 	}
 
-	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
 	if err != nil {
 		return false, fmt.Errorf("failed to list remote refs: %w", err)
 	}
@@ -207,6 +295,32 @@ func (s *Repository) BranchExistsOnRemote(ctx context.Context, branchName, remot
 	return false, nil
 }
 
+// ListRemoteBranches lists the branches of the remote with a single request.
+func (s *Repository) ListRemoteBranches(ctx context.Context, remoteName string) ([]string, error) {
+	remote, err := s.repo.Remote(remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote: %w", err)
+	}
+
+	auth, err := getSSHAuth()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ssh key: %w", err)
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote refs: %w", err)
+	}
+
+	var names []string
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			names = append(names, ref.Name().Short())
+		}
+	}
+	return names, nil
+}
+
 func (s *Repository) PushBranch(ctx context.Context, branchName, remoteName string) error {
 	remote, err := s.repo.Remote(remoteName)
 	if err != nil {
@@ -235,6 +349,233 @@ func (s *Repository) PushBranch(ctx context.Context, branchName, remoteName stri
 	return nil
 }
 
+func (s *Repository) DeleteBranch(ctx context.Context, branchName string) error {
+	if s.dryRun {
+		return nil
+	}
+
+	err := s.repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(branchName))
+	if err != nil {
+		return fmt.Errorf("failed to delete branch: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Repository) DeleteRemoteBranch(ctx context.Context, branchName, remoteName string) error {
+	remote, err := s.repo.Remote(remoteName)
+	if err != nil {
+		return fmt.Errorf("failed to get remote: %w", err)
+	}
+	if s.dryRun {
+		return nil
+	}
+
+	auth, err := getSSHAuth()
+	if err != nil {
+		return fmt.Errorf("failed to load ssh key: %w", err)
+	}
+
+	refSpec := config.RefSpec(fmt.Sprintf(":refs/heads/%s", branchName))
+	err = remote.PushContext(ctx, &git.PushOptions{
+		RefSpecs: []config.RefSpec{refSpec},
+		Auth:     auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to delete remote branch: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Repository) ResolveRevision(ctx context.Context, revision string) (string, error) {
+	hash, err := s.repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", revision, err)
+	}
+	return hash.String(), nil
+}
+
+func (s *Repository) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
+	ancestorHash, err := s.repo.ResolveRevision(plumbing.Revision(ancestor))
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve %s: %w", ancestor, err)
+	}
+	descendantHash, err := s.repo.ResolveRevision(plumbing.Revision(descendant))
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve %s: %w", descendant, err)
+	}
+	if *ancestorHash == *descendantHash {
+		return true, nil
+	}
+
+	ancestorCommit, err := s.repo.CommitObject(*ancestorHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to get commit %s: %w", ancestor, err)
+	}
+	descendantCommit, err := s.repo.CommitObject(*descendantHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to get commit %s: %w", descendant, err)
+	}
+
+	return ancestorCommit.IsAncestor(descendantCommit)
+}
+
+// ResetBranch points a branch that is not checked out at another commit.
+func (s *Repository) ResetBranch(ctx context.Context, branchName, commit string) error {
+	head, err := s.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	refName := plumbing.NewBranchReferenceName(branchName)
+	if head.Name() == refName {
+		return fmt.Errorf("refusing to reset %s while it is checked out", branchName)
+	}
+
+	if s.dryRun {
+		return nil
+	}
+
+	err = s.repo.Storer.SetReference(plumbing.NewHashReference(refName, plumbing.NewHash(commit)))
+	if err != nil {
+		return fmt.Errorf("failed to reset branch: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Repository) ListBranches(ctx context.Context) ([]string, error) {
+	branches, err := s.repo.Branches()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	defer branches.Close()
+
+	var names []string
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	return names, nil
+}
+
+func (s *Repository) Fetch(ctx context.Context, remoteName string) error {
+	remote, err := s.repo.Remote(remoteName)
+	if err != nil {
+		return fmt.Errorf("failed to get remote: %w", err)
+	}
+
+	auth, err := getSSHAuth()
+	if err != nil {
+		return fmt.Errorf("failed to load ssh key: %w", err)
+	}
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{Auth: auth})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch %s: %w", remoteName, err)
+	}
+	return nil
+}
+
+// Rebase replays the commits of branch that are not in upstream onto onto,
+// like "git rebase --onto onto upstream branch". go-git cannot rebase, so
+// this runs the git binary; a conflicting rebase is aborted and reported.
+func (s *Repository) Rebase(ctx context.Context, onto, upstream, branch string) error {
+	if s.dryRun {
+		return nil
+	}
+
+	if _, err := s.runGit(ctx, s.path, "rebase", "--onto", onto, upstream, branch); err != nil {
+		s.runGit(ctx, s.path, "rebase", "--abort")
+		return fmt.Errorf("failed to rebase %s onto %s: %w", branch, onto, err)
+	}
+	return nil
+}
+
+func (s *Repository) GetCommitChanges(ctx context.Context, hash string) (*CommitChanges, error) {
+	commit, err := s.repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of %s: %w", hash, err)
+	}
+
+	parentTree := &object.Tree{}
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent of %s: %w", hash, err)
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, fmt.Errorf("failed to get parent tree of %s: %w", hash, err)
+		}
+	}
+
+	patch, err := parentTree.Patch(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate patch for %s: %w", hash, err)
+	}
+
+	changes := &CommitChanges{Patch: patch.String()}
+	for _, filePatch := range patch.FilePatches() {
+		from, to := filePatch.Files()
+		if to != nil {
+			changes.Files = append(changes.Files, to.Path())
+		} else if from != nil {
+			changes.Files = append(changes.Files, from.Path())
+		}
+	}
+	return changes, nil
+}
+
+// CherryPickBranch creates branchName at base and cherry-picks commits onto
+// it in a temporary worktree, leaving the current checkout alone. On conflict
+// the cherry-pick is aborted, the branch is removed and a
+// *CherryPickConflictError is returned.
+func (s *Repository) CherryPickBranch(ctx context.Context, branchName, base string, commits []string) error {
+	if s.dryRun {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "branchtale-split-")
+	if err != nil {
+		return fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := s.runGit(ctx, s.path, "worktree", "add", "-q", "-b", branchName, dir, base); err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branchName, err)
+	}
+	defer s.runGit(ctx, s.path, "worktree", "remove", "--force", dir)
+
+	for _, commit := range commits {
+		if _, err := s.runGit(ctx, dir, "cherry-pick", "--allow-empty", commit); err != nil {
+			conflicts, _ := s.runGit(ctx, dir, "diff", "--name-only", "--diff-filter=U")
+			s.runGit(ctx, dir, "cherry-pick", "--abort")
+			s.runGit(ctx, s.path, "worktree", "remove", "--force", dir)
+			s.runGit(ctx, s.path, "branch", "-D", branchName)
+			if conflicts == "" {
+				return fmt.Errorf("failed to cherry-pick %s onto %s: %w", commit, branchName, err)
+			}
+			return &CherryPickConflictError{Branch: branchName, Commit: commit, Files: strings.Fields(conflicts)}
+		}
+	}
+	return nil
+}
+
+func (s *Repository) runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w\n%s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 func (s *Repository) getCommitsBetween(from, to *object.Commit) ([]*object.Commit, error) {
 	var commits []*object.Commit
 
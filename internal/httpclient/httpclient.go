@@ -0,0 +1,208 @@
+// Package httpclient provides the HTTP client shared by the YandexGPT, GitHub
+// and issue tracker clients: every attempt gets its own timeout, and
+// transient failures are retried with exponential backoff and jitter,
+// honoring Retry-After and GitHub's rate limit headers. Requests that are not
+// idempotent are only retried when the server rejected them for the rate
+// limit, since it may have handled them before failing otherwise.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts = 4
+	DefaultTimeout     = 60 * time.Second
+	DefaultBaseDelay   = 500 * time.Millisecond
+	DefaultMaxDelay    = 30 * time.Second
+)
+
+// Options configure retries. Zero values use the defaults.
+type Options struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+	// Timeout limits each attempt, including reading the response body.
+	Timeout time.Duration
+	// BaseDelay is the backoff before the second attempt; it doubles with
+	// every further attempt up to MaxDelay.
+	BaseDelay time.Duration
+	// MaxDelay also caps waits requested by the server. A server that asks
+	// to wait longer gets its response returned instead.
+	MaxDelay time.Duration
+	// RetryAllMethods treats every request as idempotent, for endpoints
+	// where repeating a POST does no harm, such as a token exchange.
+	RetryAllMethods bool
+}
+
+func New(opts Options) *http.Client {
+	return &http.Client{Transport: NewTransport(http.DefaultTransport, opts)}
+}
+
+// Transport retries requests sent through Base.
+type Transport struct {
+	Base http.RoundTripper
+	opts Options
+	now  func() time.Time
+}
+
+func NewTransport(base http.RoundTripper, opts Options) *Transport {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultMaxDelay
+	}
+	return &Transport{Base: base, opts: opts, now: time.Now}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.attempt(req)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		// A body that cannot be replayed allows a single attempt only.
+		last := attempt == t.opts.MaxAttempts || req.Body != nil && req.GetBody == nil
+
+		delay, retry := t.retryDelay(req, resp, err, attempt)
+		if !retry || last || delay > t.opts.MaxDelay {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.Timeout)
+	attemptReq := req.Clone(ctx)
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	resp, err := t.Base.RoundTrip(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryDelay decides whether a result is worth another attempt and how long
+// to wait before it.
+func (t *Transport) retryDelay(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		return t.backoff(attempt), t.idempotent(req) && !errors.Is(err, context.Canceled)
+	}
+
+	if delay, ok := t.serverDelay(resp); ok {
+		return delay, true
+	}
+	if !t.idempotent(req) {
+		return 0, false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return t.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// idempotent reports whether req may be sent again after the server could
+// have handled it. Like net/http, a request with an Idempotency-Key header
+// opts in whatever its method.
+func (t *Transport) idempotent(req *http.Request) bool {
+	if t.opts.RetryAllMethods {
+		return true
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, key := req.Header["Idempotency-Key"]
+	_, xKey := req.Header["X-Idempotency-Key"]
+	return key || xKey
+}
+
+// serverDelay reads Retry-After on 429, 503 and 403 responses, and GitHub's
+// X-RateLimit-Reset when a 403 or 429 reports the limit as exhausted.
+func (t *Transport) serverDelay(resp *http.Response) (time.Duration, bool) {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusForbidden:
+	default:
+		return 0, false
+	}
+
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(t.now()), 0), true
+		}
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable && resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Unix(reset, 0).Sub(t.now()), 0) + time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// backoff is BaseDelay doubled per attempt, capped at MaxDelay, with jitter
+// between half and the full value.
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.opts.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > t.opts.MaxDelay {
+		delay = t.opts.MaxDelay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// cancelOnClose ends the attempt's timeout context once the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,229 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var fastOptions = Options{BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+// failingServer answers with status and headers for the first failures
+// requests and with 200 and the request body afterwards.
+func failingServer(t *testing.T, failures, status int, headers map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			for key, value := range headers {
+				w.Header().Set(key, value)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte("ok:"), body...))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestClient_retriesTransientFailures(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			server, requests := failingServer(t, 2, status, nil)
+
+			req, _ := http.NewRequest(http.MethodPut, server.URL, bytes.NewBufferString("payload"))
+			resp, err := New(fastOptions).Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(body) != "ok:payload" {
+				t.Errorf("Expected the body to be replayed until success, got %d %q", resp.StatusCode, body)
+			}
+			if *requests != 3 {
+				t.Errorf("Expected 3 requests, got %d", *requests)
+			}
+		})
+	}
+}
+
+func TestClient_doesNotRepeatHandledPost(t *testing.T) {
+	var handled []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		handled = append(handled, string(body))
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	resp, err := New(fastOptions).Post(server.URL, "application/json", bytes.NewBufferString(`{"title":"Add cache"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || len(handled) != 1 {
+		t.Errorf("Expected the 502 without sending the POST again, got %d after %d requests", resp.StatusCode, len(handled))
+	}
+
+	handled = nil
+	req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString("payload"))
+	req.Header.Set("Idempotency-Key", "1")
+	resp, err = New(Options{MaxAttempts: 2, BaseDelay: time.Millisecond}).Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if len(handled) != 2 {
+		t.Errorf("Expected a POST with an Idempotency-Key to be retried, got %d requests", len(handled))
+	}
+
+	handled = nil
+	resp, err = New(Options{MaxAttempts: 2, BaseDelay: time.Millisecond, RetryAllMethods: true}).Post(server.URL, "text/plain", bytes.NewBufferString("payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if len(handled) != 2 {
+		t.Errorf("Expected RetryAllMethods to retry the POST, got %d requests", len(handled))
+	}
+}
+
+func TestClient_retriesRateLimitedPost(t *testing.T) {
+	server, requests := failingServer(t, 1, http.StatusTooManyRequests, map[string]string{"Retry-After": "0"})
+
+	resp, err := New(fastOptions).Post(server.URL, "text/plain", bytes.NewBufferString("payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("Expected a rate limited POST to be retried, got %d after %d requests", resp.StatusCode, *requests)
+	}
+
+	server, requests = failingServer(t, 1, http.StatusServiceUnavailable, nil)
+	resp, err = New(fastOptions).Post(server.URL, "text/plain", bytes.NewBufferString("payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || *requests != 1 {
+		t.Errorf("Expected a 503 without Retry-After to be returned, got %d after %d requests", resp.StatusCode, *requests)
+	}
+}
+
+func TestClient_givesUpAfterMaxAttempts(t *testing.T) {
+	server, requests := failingServer(t, 10, http.StatusBadGateway, nil)
+
+	resp, err := New(Options{MaxAttempts: 3, BaseDelay: time.Millisecond}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || *requests != 3 {
+		t.Errorf("Expected the last failure after 3 requests, got %d after %d", resp.StatusCode, *requests)
+	}
+}
+
+func TestClient_doesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusForbidden, http.StatusUnprocessableEntity} {
+		server, requests := failingServer(t, 1, status, nil)
+
+		resp, err := New(fastOptions).Get(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status || *requests != 1 {
+			t.Errorf("Expected %d without retry, got %d after %d requests", status, resp.StatusCode, *requests)
+		}
+	}
+}
+
+func TestClient_retryAfter(t *testing.T) {
+	server, requests := failingServer(t, 1, http.StatusTooManyRequests, map[string]string{"Retry-After": "1"})
+
+	started := time.Now()
+	resp, err := New(Options{BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("Expected success on the second request, got %d after %d", resp.StatusCode, *requests)
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("Expected to wait for Retry-After, waited %s", elapsed)
+	}
+}
+
+func TestClient_githubRateLimit(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	server, requests := failingServer(t, 1, http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset})
+
+	resp, err := New(fastOptions).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || *requests != 1 {
+		t.Errorf("Expected a reset beyond MaxDelay to be returned right away, got %d after %d requests", resp.StatusCode, *requests)
+	}
+
+	transport := NewTransport(http.DefaultTransport, fastOptions)
+	transport.now = func() time.Time { return time.Now().Add(time.Hour) }
+	resp, err = (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a retry once the rate limit resets, got %d", resp.StatusCode)
+	}
+}
+
+func TestClient_contextCancellation(t *testing.T) {
+	server, requests := failingServer(t, 10, http.StatusServiceUnavailable, map[string]string{"Retry-After": "1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	_, err := New(Options{MaxDelay: 5 * time.Second}).Do(req)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Expected the wait to end with the context, got %v", err)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected 1 request, got %d", *requests)
+	}
+}
+
+func TestClient_attemptTimeout(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	resp, err := New(Options{Timeout: 50 * time.Millisecond, BaseDelay: time.Millisecond}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" || requests.Load() != 2 {
+		t.Errorf("Expected a retry after the slow attempt timed out, got %q after %d requests", body, requests.Load())
+	}
+}
@@ -0,0 +1,195 @@
+package pr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/deck/branchtale/internal/ai"
+)
+
+const (
+	maxSlugLength         = 50
+	maxBranchNameAttempts = 100
+)
+
+var conventionalPattern = regexp.MustCompile(`^([a-z]+)(\([^)]*\))?!?:`)
+
+// ValidateBranchName checks a branch name against the rules of
+// git check-ref-format for refs/heads/<name>.
+func ValidateBranchName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("branch name is empty")
+	case name == "@":
+		return fmt.Errorf("branch name cannot be '@'")
+	case strings.HasPrefix(name, "-"):
+		return fmt.Errorf("branch name %q cannot start with '-'", name)
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return fmt.Errorf("branch name %q cannot start or end with '/'", name)
+	case strings.HasSuffix(name, "."):
+		return fmt.Errorf("branch name %q cannot end with '.'", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("branch name %q cannot contain '..'", name)
+	case strings.Contains(name, "//"):
+		return fmt.Errorf("branch name %q cannot contain '//'", name)
+	case strings.Contains(name, "@{"):
+		return fmt.Errorf("branch name %q cannot contain '@{'", name)
+	}
+
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("branch name %q cannot contain %q", name, r)
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("branch name %q has an invalid component %q", name, component)
+		}
+	}
+	return nil
+}
+
+// cleanBranchName makes a name typed or refined by hand usable as a branch:
+// it keeps case and '/', transliterates Cyrillic and replaces anything git
+// would reject with '-'.
+func cleanBranchName(name string) string {
+	name = strings.Trim(strings.TrimSpace(name), "\"'`")
+
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		var b strings.Builder
+		for _, r := range segment {
+			if latin, ok := ai.Transliterate(r); ok {
+				if unicode.IsUpper(r) && latin != "" {
+					latin = strings.ToUpper(latin[:1]) + latin[1:]
+				}
+				b.WriteString(latin)
+				continue
+			}
+			if r < 0x20 || r == 0x7f || unicode.IsSpace(r) || strings.ContainsRune("~^:?*[\\@{}", r) {
+				r = '-'
+			}
+			b.WriteRune(r)
+		}
+		segment = collapseDashes(b.String())
+		segment = strings.TrimSuffix(strings.Trim(segment, "-."), ".lock")
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// renderBranchTemplate fills {type}, {ticket} and {slug} in template and drops
+// the separators around placeholders that turned out empty.
+func renderBranchTemplate(template, branchType, ticket, slug string) string {
+	name := strings.NewReplacer("{type}", branchType, "{ticket}", ticket, "{slug}", slug).Replace(template)
+	return cleanBranchName(name)
+}
+
+func collapseDashes(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "-")
+	}
+	return s
+}
+
+// branchType is the conventional commit type of the first commit that has
+// one, or "feature".
+func branchType(subjects []string) string {
+	for _, subject := range subjects {
+		if m := conventionalPattern.FindStringSubmatch(subject); m != nil {
+			return m[1]
+		}
+	}
+	return "feature"
+}
+
+// branchName builds the branch name for a generated slug: it sanitizes the
+// slug, falls back to the first commit subject when nothing usable is left,
+// applies the prefix and template, validates the result and makes it unique.
+func (s *Service) branchName(ctx context.Context, slug string, input *ai.Input, reserved map[string]bool) (string, error) {
+	slug = ai.SanitizeBranchSlug(slug, maxSlugLength)
+	if slug == "" && len(input.Commits) > 0 {
+		slug = ai.SanitizeBranchSlug(conventionalPattern.ReplaceAllString(input.Commits[0], ""), maxSlugLength)
+	}
+	if slug == "" {
+		slug = "changes"
+	}
+
+	name := s.config.BranchPrefix + renderBranchTemplate(s.branchTemplate(), branchType(input.Commits), s.templateTicket(input), slug)
+	return s.availableBranchName(ctx, name, reserved)
+}
+
+// branchSlug recovers the slug from a name built by branchName by stripping
+// the prefix and the parts the template adds around {slug}. The whole name
+// without the prefix is returned when the template has no {slug}.
+func (s *Service) branchSlug(name string, input *ai.Input) string {
+	const marker = "branchtaleslug"
+
+	name = strings.TrimPrefix(name, s.config.BranchPrefix)
+	rendered := renderBranchTemplate(s.branchTemplate(), branchType(input.Commits), s.templateTicket(input), marker)
+	before, after, ok := strings.Cut(rendered, marker)
+	if !ok {
+		return name
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, before), after)
+}
+
+// templateTicket is the ticket for {ticket}, or "" when the prefix already
+// names it, so the key does not appear twice in the branch name.
+func (s *Service) templateTicket(input *ai.Input) string {
+	ticket := strings.TrimPrefix(input.Ticket, "#")
+	if ticket == "" || strings.Contains(s.config.BranchPrefix, ticket) {
+		return ""
+	}
+	return ticket
+}
+
+func (s *Service) branchTemplate() string {
+	if s.config.BranchTemplate == "" {
+		return "{slug}"
+	}
+	return s.config.BranchTemplate
+}
+
+// availableBranchName validates name and appends -2, -3, ... until it names
+// neither a local nor a remote branch, nor one in reserved.
+func (s *Service) availableBranchName(ctx context.Context, name string, reserved map[string]bool) (string, error) {
+	if err := ValidateBranchName(name); err != nil {
+		return "", err
+	}
+
+	branches, err := s.git.ListBranches(ctx)
+	if err != nil {
+		return "", err
+	}
+	taken := map[string]bool{}
+	for _, branch := range branches {
+		taken[branch] = true
+	}
+	remoteBranches, err := s.git.ListRemoteBranches(ctx, "origin")
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote branches: %w", err)
+	}
+	for _, branch := range remoteBranches {
+		taken[branch] = true
+	}
+	for branch := range reserved {
+		taken[branch] = true
+	}
+
+	for n := 1; n <= maxBranchNameAttempts; n++ {
+		candidate := name
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d", name, n)
+		}
+		if !taken[candidate] {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free branch name found for %s", name)
+}
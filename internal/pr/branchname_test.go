@@ -0,0 +1,128 @@
+package pr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+)
+
+func TestValidateBranchName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"feature/add-cache", false},
+		{"ABC-123-fix", false},
+		{"", true},
+		{"@", true},
+		{"-starts-with-dash", true},
+		{"/leading-slash", true},
+		{"trailing-slash/", true},
+		{"double//slash", true},
+		{"ends-with-dot.", true},
+		{"two..dots", true},
+		{"feature/.hidden", true},
+		{"feature/x.lock", true},
+		{"has space", true},
+		{"has:colon", true},
+		{"tilde~1", true},
+		{"reflog@{1}", true},
+		{"new\nline", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBranchName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBranchName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCleanBranchName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"feature/ABC-1 add cache", "feature/ABC-1-add-cache"},
+		{"'feature//x.lock'", "feature/x"},
+		{"фича/Кэш-ответов", "ficha/Kesh-otvetov"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanBranchName(tt.input); got != tt.want {
+			t.Errorf("cleanBranchName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRenderBranchTemplate(t *testing.T) {
+	tests := []struct {
+		template, branchType, ticket, want string
+	}{
+		{"{type}/{ticket}-{slug}", "feat", "ABC-123", "feat/ABC-123-add-cache"},
+		{"{type}/{ticket}-{slug}", "feature", "", "feature/add-cache"},
+		{"{ticket}/{slug}", "feature", "", "add-cache"},
+		{"{slug}", "feature", "ABC-1", "add-cache"},
+	}
+
+	for _, tt := range tests {
+		if got := renderBranchTemplate(tt.template, tt.branchType, tt.ticket, "add-cache"); got != tt.want {
+			t.Errorf("renderBranchTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestService_branchName(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	gitRepo.localBranches["feat/ABC-7-add-cache"] = true
+	gitRepo.remoteBranches["feat/ABC-7-add-cache-2"] = true
+	gitRepo.remoteBranches["feat/ABC-7-add-cache-3"] = true
+	s := newTestService(&config.Config{BranchTemplate: "{type}/{ticket}-{slug}"}, gitRepo, newFakeGenerator(), newFakeProvider())
+
+	name, err := s.branchName(context.Background(), "'Add Cache'", &ai.Input{Commits: []string{"feat(cache): ABC-7 add cache"}, Ticket: "ABC-7"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name != "feat/ABC-7-add-cache-4" {
+		t.Errorf("Expected suffix past local and remote branches, got %s", name)
+	}
+	if gitRepo.remoteLists != 1 {
+		t.Errorf("Expected the remote branches to be listed once, got %d", gitRepo.remoteLists)
+	}
+}
+
+func TestService_branchName_ticketInPrefix(t *testing.T) {
+	s := newTestService(&config.Config{BranchPrefix: "ABC-7/", BranchTemplate: "{type}/{ticket}-{slug}"}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+
+	name, err := s.branchName(context.Background(), "add-cache", &ai.Input{Commits: []string{"feat: add cache"}, Ticket: "ABC-7"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "ABC-7/feat/add-cache" {
+		t.Errorf("expected the ticket only in the prefix, got %s", name)
+	}
+}
+
+func TestService_branchName_fallsBackToSubject(t *testing.T) {
+	s := newTestService(&config.Config{BranchPrefix: "dev/"}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+
+	name, err := s.branchName(context.Background(), "", &ai.Input{Commits: []string{"fix: Handle empty config"}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name != "dev/handle-empty-config" {
+		t.Errorf("Expected name from the commit subject, got %s", name)
+	}
+}
+
+func TestService_branchName_invalidPrefix(t *testing.T) {
+	s := newTestService(&config.Config{BranchPrefix: "my prefix/"}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+
+	if _, err := s.branchName(context.Background(), "add-cache", &ai.Input{}, nil); err == nil {
+		t.Error("Expected an invalid prefix to be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package pr
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// orderedOutput keeps the output of concurrent tasks apart: the first
+// unfinished section writes through, later ones are buffered until every
+// section before them is closed.
+type orderedOutput struct {
+	mu       sync.Mutex
+	out      io.Writer
+	sections []*outputSection
+	current  int
+}
+
+type outputSection struct {
+	output *orderedOutput
+	index  int
+	buf    bytes.Buffer
+	closed bool
+}
+
+func newOrderedOutput(out io.Writer, n int) *orderedOutput {
+	o := &orderedOutput{out: out}
+	for i := range n {
+		o.sections = append(o.sections, &outputSection{output: o, index: i})
+	}
+	return o
+}
+
+func (o *orderedOutput) section(i int) *outputSection {
+	return o.sections[i]
+}
+
+func (s *outputSection) Write(p []byte) (int, error) {
+	s.output.mu.Lock()
+	defer s.output.mu.Unlock()
+	if s.index == s.output.current {
+		return s.output.out.Write(p)
+	}
+	return s.buf.Write(p)
+}
+
+// Close marks the section as finished and lets the next one write through,
+// after what it buffered so far.
+func (s *outputSection) Close() error {
+	o := s.output
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s.closed = true
+	for o.current < len(o.sections) && o.sections[o.current].closed {
+		o.current++
+		if o.current < len(o.sections) {
+			next := o.sections[o.current]
+			if _, err := next.buf.WriteTo(o.out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
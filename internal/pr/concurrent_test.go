@@ -0,0 +1,64 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+)
+
+func TestOrderedOutput(t *testing.T) {
+	var out bytes.Buffer
+	output := newOrderedOutput(&out, 3)
+	first, second, third := output.section(0), output.section(1), output.section(2)
+
+	fmt.Fprint(third, "c1 ")
+	fmt.Fprint(second, "b1 ")
+	fmt.Fprint(first, "a1 ")
+	if out.String() != "a1 " {
+		t.Errorf("Expected only the first section to write through, got %q", out.String())
+	}
+
+	third.Close()
+	fmt.Fprint(second, "b2 ")
+	first.Close()
+	fmt.Fprint(second, "b3 ")
+	second.Close()
+	if out.String() != "a1 b1 b2 b3 c1 " {
+		t.Errorf("Expected the sections in order, got %q", out.String())
+	}
+}
+
+// blockingGenerator waits for its context to end when generating a description.
+type blockingGenerator struct {
+	*fakeGenerator
+}
+
+func (g blockingGenerator) GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestService_generateFields(t *testing.T) {
+	s := newTestService(&config.Config{}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+
+	content, err := s.generateFields(context.Background(), s.generator, &ai.Input{}, ai.KindBranchName, ai.KindTitle, ai.KindDescription)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content.BranchName != "add-response-cache" || content.Title != "Add response cache" || content.Description != "Adds a cache for responses." {
+		t.Errorf("Unexpected content: %+v", content)
+	}
+
+	generator := newFakeGenerator()
+	generator.errs["GeneratePRTitle"] = errors.New("boom")
+	_, err = s.generateFields(context.Background(), blockingGenerator{generator}, &ai.Input{}, ai.KindTitle, ai.KindDescription)
+	if err == nil || !strings.Contains(err.Error(), "failed to generate PR title: boom") {
+		t.Errorf("Expected the title error to cancel the description, got %v", err)
+	}
+}
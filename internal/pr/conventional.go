@@ -0,0 +1,162 @@
+package pr
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+)
+
+var (
+	conventionalTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+	conventionalTitlePattern = regexp.MustCompile(`^([a-z]+)(\(([^()\s]+)\))?(!)?: (\S.*)$`)
+	conventionalPrefix       = regexp.MustCompile(`^\s*[A-Za-z]+(\([^)]*\))?!?:\s*`)
+)
+
+// ValidateConventionalTitle checks a title against the Conventional Commits
+// header format, type(scope)!: description, with one of the common types.
+func ValidateConventionalTitle(title string) error {
+	m := conventionalTitlePattern.FindStringSubmatch(title)
+	if m == nil {
+		return fmt.Errorf("title %q is not in Conventional Commits format 'type(scope): subject'", title)
+	}
+	if !slices.Contains(conventionalTypes, m[1]) {
+		return fmt.Errorf("title %q has unknown type %q (expected one of %s)", title, m[1], strings.Join(conventionalTypes, ", "))
+	}
+	return nil
+}
+
+// inferConventional guesses the type of a change from the first commit with a
+// conventional prefix, or else from the changed files, and its scope from the
+// directory with the most changed files.
+func inferConventional(commits, files []string) *ai.Conventional {
+	c := &ai.Conventional{Type: "feat", Scope: conventionalScope(files)}
+	for _, subject := range commits {
+		if m := conventionalPattern.FindStringSubmatch(subject); m != nil && slices.Contains(conventionalTypes, m[1]) {
+			c.Type = m[1]
+			return c
+		}
+	}
+
+	switch {
+	case len(files) > 0 && !slices.ContainsFunc(files, func(f string) bool { return !isTestFile(f) }):
+		c.Type = "test"
+	case len(files) > 0 && !slices.ContainsFunc(files, func(f string) bool { return !isDocFile(f) }):
+		c.Type = "docs"
+	case len(commits) > 0 && strings.HasPrefix(strings.ToLower(commits[0]), "fix"):
+		c.Type = "fix"
+	}
+	return c
+}
+
+func conventionalScope(files []string) string {
+	counts := map[string]int{}
+	for _, file := range files {
+		if dir := path.Dir(file); dir != "." {
+			counts[dir]++
+		}
+	}
+
+	best := ""
+	for dir, n := range counts {
+		if n > counts[best] || n == counts[best] && dir < best {
+			best = dir
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return strings.ToLower(path.Base(best))
+}
+
+func isTestFile(file string) bool {
+	base := path.Base(file)
+	return strings.HasSuffix(base, "_test.go") ||
+		strings.Contains(base, ".test.") || strings.Contains(base, ".spec.") ||
+		slices.ContainsFunc(strings.Split(path.Dir(file), "/"), func(dir string) bool {
+			return dir == "testdata" || dir == "test" || dir == "tests"
+		})
+}
+
+func isDocFile(file string) bool {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".md", ".markdown", ".rst", ".adoc", ".txt":
+		return true
+	}
+	return strings.HasPrefix(file, "docs/") || strings.HasPrefix(path.Base(file), "LICENSE")
+}
+
+// conventionalTitle turns a generated title into type(scope): subject. A title
+// that already has a valid header keeps it; otherwise any partial header is
+// dropped and the inferred one is used. An empty subject falls back to the
+// issue title or the first commit subject.
+func conventionalTitle(title string, input *ai.Input) (header, subject string) {
+	title = strings.TrimSpace(title)
+	if line, _, ok := strings.Cut(title, "\n"); ok {
+		title = line
+	}
+	title = strings.Trim(title, "\"'`")
+
+	if m := conventionalTitlePattern.FindStringSubmatch(title); m != nil && slices.Contains(conventionalTypes, m[1]) {
+		header, subject = strings.TrimSuffix(title, m[5]), m[5]
+	} else {
+		header = input.Conventional.Type
+		if input.Conventional.Scope != "" {
+			header += "(" + input.Conventional.Scope + ")"
+		}
+		header += ": "
+		subject = conventionalPrefix.ReplaceAllString(title, "")
+	}
+
+	if subject == "" && input.Issue != nil {
+		subject = input.Issue.Title
+	}
+	if subject == "" && len(input.Commits) > 0 {
+		subject = conventionalPrefix.ReplaceAllString(input.Commits[0], "")
+	}
+	return header, lowerFirst(strings.TrimRight(strings.TrimSpace(subject), "."))
+}
+
+// lowerFirst lowercases the first letter unless the first word looks like
+// an acronym.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	next, _ := utf8.DecodeRuneInString(s[size:])
+	if unicode.IsUpper(next) {
+		return s
+	}
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+// formatTitle applies the title style and template to a generated title.
+// Conventional titles are validated, so a malformed title never reaches the
+// pull request.
+func (s *Service) formatTitle(title string, input *ai.Input) (string, error) {
+	if input.Conventional == nil {
+		return s.withTicketTitle(title, input.Ticket), nil
+	}
+	header, subject := conventionalTitle(title, input)
+	title = header + s.withTicketTitle(subject, input.Ticket)
+	if err := ValidateConventionalTitle(title); err != nil {
+		return "", err
+	}
+	return title, nil
+}
+
+// checkTitle validates a title that may have been edited or read from a plan.
+func (s *Service) checkTitle(title string) error {
+	if s.config.TitleStyle != config.TitleStyleConventional {
+		return nil
+	}
+	return ValidateConventionalTitle(title)
+}
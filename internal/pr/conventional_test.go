@@ -0,0 +1,86 @@
+package pr
+
+import (
+	"testing"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+)
+
+func TestValidateConventionalTitle(t *testing.T) {
+	tests := []struct {
+		title   string
+		wantErr bool
+	}{
+		{"feat: add cache", false},
+		{"fix(pr): handle empty diff", false},
+		{"refactor(api)!: drop v1 routes", false},
+		{"Add cache", true},
+		{"feat:add cache", true},
+		{"feat: ", true},
+		{"Feat: add cache", true},
+		{"feature: add cache", true},
+		{"feat(): add cache", true},
+		{"feat(my scope): add cache", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateConventionalTitle(tt.title)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateConventionalTitle(%q) error = %v, wantErr %v", tt.title, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInferConventional(t *testing.T) {
+	tests := []struct {
+		name      string
+		commits   []string
+		files     []string
+		wantType  string
+		wantScope string
+	}{
+		{"commit prefix", []string{"Update docs", "perf(cache): avoid copies"}, []string{"internal/cache/cache.go"}, "perf", "cache"},
+		{"tests only", []string{"Cover edge cases"}, []string{"internal/pr/review_test.go", "internal/pr/testdata/diff.txt"}, "test", "pr"},
+		{"docs only", []string{"Describe setup"}, []string{"README.md", "docs/setup.md"}, "docs", "docs"},
+		{"fix subject", []string{"Fix crash on empty diff"}, []string{"main.go"}, "fix", ""},
+		{"most touched directory", nil, []string{"internal/ai/local.go", "internal/pr/a.go", "internal/pr/b.go"}, "feat", "pr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inferConventional(tt.commits, tt.files)
+			if got.Type != tt.wantType || got.Scope != tt.wantScope {
+				t.Errorf("Expected %s(%s), got %s(%s)", tt.wantType, tt.wantScope, got.Type, got.Scope)
+			}
+		})
+	}
+}
+
+func TestService_formatTitle_conventional(t *testing.T) {
+	s := newTestService(&config.Config{TitleStyle: config.TitleStyleConventional, TitleTemplate: "{ticket} {title}"}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	input := &ai.Input{Commits: []string{"Add response cache."}, Conventional: &ai.Conventional{Type: "feat", Scope: "cache"}}
+
+	tests := []struct {
+		generated string
+		ticket    string
+		want      string
+	}{
+		{"fix(api): handle timeouts", "", "fix(api): handle timeouts"},
+		{"Add LRU cache.", "", "feat(cache): add LRU cache"},
+		{"Feature: Cache responses", "", "feat(cache): cache responses"},
+		{"", "", "feat(cache): add response cache"},
+		{"Add cache", "PROJ-1", "feat(cache): PROJ-1 add cache"},
+	}
+
+	for _, tt := range tests {
+		input.Ticket = tt.ticket
+		got, err := s.formatTitle(tt.generated, input)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", tt.generated, err)
+		}
+		if got != tt.want {
+			t.Errorf("formatTitle(%q) = %q, want %q", tt.generated, got, tt.want)
+		}
+	}
+}
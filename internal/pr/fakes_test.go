@@ -0,0 +1,389 @@
+package pr
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/git"
+	"github.com/deck/branchtale/internal/vcs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type fakeGit struct {
+	info           *git.RepoInfo
+	diff           *git.DiffInfo
+	remoteURL      string
+	remoteBranches map[string]bool
+	localBranches  map[string]bool
+	current        string
+	pushed         []string
+	revisions      map[string]string
+	ancestors      map[string][]string
+	diverged       bool
+	rebased        []string
+	changes        map[string]*git.CommitChanges
+	cherryPicked   map[string][]string
+	fetches        int
+	remoteLists    int
+	errs           map[string]error
+}
+
+func newFakeGit(current string) *fakeGit {
+	return &fakeGit{
+		info: &git.RepoInfo{
+			CurrentBranch: current,
+			MainBranch:    "main",
+			IsOnMain:      current == "main",
+		},
+		diff: &git.DiffInfo{
+			Diff:    "diff --git a/cache.go b/cache.go",
+			Commits: []*object.Commit{fakeCommit("1111111111111111111111111111111111111111", "Add cache")},
+		},
+		remoteURL:      "git@github.com:owner/repo.git",
+		remoteBranches: map[string]bool{},
+		localBranches:  map[string]bool{"main": true, current: true},
+		current:        current,
+		revisions: map[string]string{
+			"main":        "2222222222222222222222222222222222222222",
+			"origin/main": "3333333333333333333333333333333333333333",
+		},
+		ancestors:    map[string][]string{},
+		changes:      map[string]*git.CommitChanges{},
+		cherryPicked: map[string][]string{},
+		errs:         map[string]error{},
+	}
+}
+
+func fakeCommit(hash, message string) *object.Commit {
+	return &object.Commit{Hash: plumbing.NewHash(hash), Message: message}
+}
+
+func (f *fakeGit) GetInfo() (*git.RepoInfo, error) {
+	if err := f.errs["GetInfo"]; err != nil {
+		return nil, err
+	}
+	info := *f.info
+	info.CurrentBranch = f.current
+	info.IsOnMain = f.current == info.MainBranch
+	return &info, nil
+}
+
+func (f *fakeGit) GetRemoteUrl(ctx context.Context, name string) (string, error) {
+	if err := f.errs["GetRemoteUrl"]; err != nil {
+		return "", err
+	}
+	return f.remoteURL, nil
+}
+
+func (f *fakeGit) GetDiffBetweenBranches(ctx context.Context, remote, remoteBranch, localBranch string) (*git.DiffInfo, error) {
+	if err := f.errs["GetDiffBetweenBranches"]; err != nil {
+		return nil, err
+	}
+	return f.diff, nil
+}
+
+func (f *fakeGit) CreateBranch(ctx context.Context, branchName string) error {
+	if err := f.errs["CreateBranch"]; err != nil {
+		return err
+	}
+	f.localBranches[branchName] = true
+	return nil
+}
+
+func (f *fakeGit) CheckoutBranch(ctx context.Context, branchName string) error {
+	if err := f.errs["CheckoutBranch"]; err != nil {
+		return err
+	}
+	if !f.localBranches[branchName] {
+		return fmt.Errorf("branch %s does not exist", branchName)
+	}
+	f.current = branchName
+	return nil
+}
+
+func (f *fakeGit) BranchExistsOnRemote(ctx context.Context, branchName, remoteName string) (bool, error) {
+	if err := f.errs["BranchExistsOnRemote"]; err != nil {
+		return false, err
+	}
+	return f.remoteBranches[branchName], nil
+}
+
+func (f *fakeGit) ListRemoteBranches(ctx context.Context, remoteName string) ([]string, error) {
+	f.remoteLists++
+	if err := f.errs["ListRemoteBranches"]; err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, exists := range f.remoteBranches {
+		if exists {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (f *fakeGit) PushBranch(ctx context.Context, branchName, remoteName string) error {
+	if err := f.errs["PushBranch"]; err != nil {
+		return err
+	}
+	f.remoteBranches[branchName] = true
+	f.pushed = append(f.pushed, branchName)
+	return nil
+}
+
+func (f *fakeGit) DeleteBranch(ctx context.Context, branchName string) error {
+	if err := f.errs["DeleteBranch"]; err != nil {
+		return err
+	}
+	if f.current == branchName {
+		return fmt.Errorf("cannot delete checked out branch %s", branchName)
+	}
+	delete(f.localBranches, branchName)
+	return nil
+}
+
+func (f *fakeGit) DeleteRemoteBranch(ctx context.Context, branchName, remoteName string) error {
+	if err := f.errs["DeleteRemoteBranch"]; err != nil {
+		return err
+	}
+	delete(f.remoteBranches, branchName)
+	return nil
+}
+
+func (f *fakeGit) ResolveRevision(ctx context.Context, revision string) (string, error) {
+	if err := f.errs["ResolveRevision"]; err != nil {
+		return "", err
+	}
+	hash, ok := f.revisions[revision]
+	if !ok {
+		return "", fmt.Errorf("unknown revision %s", revision)
+	}
+	return hash, nil
+}
+
+func (f *fakeGit) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
+	if err := f.errs["IsAncestor"]; err != nil {
+		return false, err
+	}
+	if ancestors, ok := f.ancestors[descendant]; ok {
+		return ancestor == descendant || slices.Contains(ancestors, ancestor), nil
+	}
+	return !f.diverged, nil
+}
+
+func (f *fakeGit) ResetBranch(ctx context.Context, branchName, hash string) error {
+	if err := f.errs["ResetBranch"]; err != nil {
+		return err
+	}
+	if f.current == branchName {
+		return fmt.Errorf("cannot reset checked out branch %s", branchName)
+	}
+	f.revisions[branchName] = hash
+	return nil
+}
+
+func (f *fakeGit) ListBranches(ctx context.Context) ([]string, error) {
+	if err := f.errs["ListBranches"]; err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(f.localBranches)), nil
+}
+
+func (f *fakeGit) Fetch(ctx context.Context, remoteName string) error {
+	f.fetches++
+	return f.errs["Fetch"]
+}
+
+func (f *fakeGit) Rebase(ctx context.Context, onto, upstream, branch string) error {
+	if err := f.errs["Rebase"]; err != nil {
+		return err
+	}
+	f.rebased = append(f.rebased, fmt.Sprintf("%s..%s->%s", upstream, branch, onto))
+	f.current = branch
+	return nil
+}
+
+func (f *fakeGit) GetCommitChanges(ctx context.Context, hash string) (*git.CommitChanges, error) {
+	changes, ok := f.changes[hash]
+	if !ok {
+		return nil, fmt.Errorf("unknown commit %s", hash)
+	}
+	return changes, nil
+}
+
+func (f *fakeGit) CherryPickBranch(ctx context.Context, branchName, base string, commits []string) error {
+	if err := f.errs["CherryPickBranch "+branchName]; err != nil {
+		return err
+	}
+	f.localBranches[branchName] = true
+	f.cherryPicked[branchName] = commits
+	return nil
+}
+
+type memoryStateStore struct {
+	state *State
+	saves int
+}
+
+func (m *memoryStateStore) Load() (*State, error) {
+	return m.state, nil
+}
+
+func (m *memoryStateStore) Save(state *State) error {
+	m.saves++
+	m.state = state
+	return nil
+}
+
+func (m *memoryStateStore) Clear() error {
+	m.state = nil
+	return nil
+}
+
+type fakeGenerator struct {
+	mu          sync.Mutex
+	title       string
+	description string
+	branchName  string
+	labels      []string
+	calls       int
+	history     []ai.Revision
+	errs        map[string]error
+}
+
+func newFakeGenerator() *fakeGenerator {
+	return &fakeGenerator{
+		title:       "Add response cache",
+		description: "Adds a cache for responses.",
+		branchName:  "add-response-cache",
+		errs:        map[string]error{},
+	}
+}
+
+func (g *fakeGenerator) GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	return g.title, g.errs["GeneratePRTitle"]
+}
+
+func (g *fakeGenerator) GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	return g.description, g.errs["GeneratePRDescription"]
+}
+
+func (g *fakeGenerator) GenerateBranchName(ctx context.Context, input *ai.Input) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	return g.branchName, g.errs["GenerateBranchName"]
+}
+
+func (g *fakeGenerator) GenerateContent(ctx context.Context, input *ai.Input) (*ai.Content, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	if err := g.errs["GenerateContent"]; err != nil {
+		return nil, err
+	}
+	content := &ai.Content{Title: g.title, Description: g.description, Labels: g.labels}
+	if input.Branch == "" {
+		content.BranchName = g.branchName
+	}
+	return content, nil
+}
+
+func (g *fakeGenerator) Refine(ctx context.Context, kind ai.ContentKind, input *ai.Input, history []ai.Revision) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	g.history = append([]ai.Revision(nil), history...)
+	return fmt.Sprintf("Refined %s #%d", kind, len(history)), g.errs["Refine"]
+}
+
+// fakeProvider is an in-memory VCSProvider that keeps pull requests in a slice.
+type fakeProvider struct {
+	pullRequests []*fakePullRequest
+	errs         map[string]error
+}
+
+type fakePullRequest struct {
+	vcs.CreatePullRequestRequest
+	Number int
+	Merged bool
+	Closed bool
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{errs: map[string]error{}}
+}
+
+func (p *fakeProvider) CreatePullRequest(ctx context.Context, req *vcs.CreatePullRequestRequest) (*vcs.CreatePullRequestResponse, error) {
+	if err := p.errs["CreatePullRequest"]; err != nil {
+		return nil, err
+	}
+	pr := &fakePullRequest{CreatePullRequestRequest: *req, Number: len(p.pullRequests) + 1}
+	p.pullRequests = append(p.pullRequests, pr)
+	return &vcs.CreatePullRequestResponse{
+		URL:    fmt.Sprintf("https://github.com/%s/%s/pull/%d", req.Owner, req.Repo, pr.Number),
+		Number: pr.Number,
+	}, nil
+}
+
+func (p *fakeProvider) FindPullRequest(ctx context.Context, req *vcs.FindPullRequestRequest) (*vcs.PullRequest, error) {
+	if err := p.errs["FindPullRequest"]; err != nil {
+		return nil, err
+	}
+	for i := len(p.pullRequests) - 1; i >= 0; i-- {
+		pr := p.pullRequests[i]
+		if pr.HeadBranch == req.HeadBranch {
+			return &vcs.PullRequest{
+				Number:      pr.Number,
+				URL:         fmt.Sprintf("https://github.com/%s/%s/pull/%d", req.Owner, req.Repo, pr.Number),
+				Title:       pr.Title,
+				Description: pr.Description,
+				HeadBranch:  pr.HeadBranch,
+				BaseBranch:  pr.BaseBranch,
+				Open:        !pr.Merged && !pr.Closed,
+				Merged:      pr.Merged,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *fakeProvider) UpdatePullRequest(ctx context.Context, req *vcs.UpdatePullRequestRequest) error {
+	if err := p.errs["UpdatePullRequest"]; err != nil {
+		return err
+	}
+	if req.Number < 1 || req.Number > len(p.pullRequests) {
+		return fmt.Errorf("pull request #%d not found", req.Number)
+	}
+	pr := p.pullRequests[req.Number-1]
+	if req.Description != "" {
+		pr.Description = req.Description
+	}
+	if req.BaseBranch != "" {
+		pr.BaseBranch = req.BaseBranch
+	}
+	return nil
+}
+
+func (p *fakeProvider) MergePullRequest(ctx context.Context, req *vcs.MergePullRequestRequest) (*vcs.MergePullRequestResponse, error) {
+	if err := p.errs["MergePullRequest"]; err != nil {
+		return nil, err
+	}
+	if req.Number < 1 || req.Number > len(p.pullRequests) {
+		return nil, fmt.Errorf("pull request #%d not found", req.Number)
+	}
+	p.pullRequests[req.Number-1].Merged = true
+	return &vcs.MergePullRequestResponse{SHA: "abc123", Merged: true, Message: "Pull Request successfully merged"}, nil
+}
@@ -0,0 +1,222 @@
+package pr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/fatih/color"
+)
+
+// DefaultFallbackTimeout is how long a generator of a FallbackGenerator may
+// take before the next one is tried.
+const DefaultFallbackTimeout = 2 * time.Minute
+
+// errEmptyAnswer fails the validation of an answer without text.
+var errEmptyAnswer = errors.New("empty answer")
+
+// FallbackGenerator is a ContentGenerator that tries a list of generators in
+// order: a failure, a timeout or an answer that fails validation falls
+// through to the next one. The last generator is the last resort, so it has
+// no timeout and its answer only has to have what a pull request cannot do
+// without: a title. An empty description or branch name is fine, the
+// service fills in the branch name from the commits.
+type FallbackGenerator struct {
+	generators []namedGenerator
+	timeout    time.Duration
+	out        io.Writer
+}
+
+type namedGenerator struct {
+	name      string
+	generator ContentGenerator
+}
+
+func NewFallbackGenerator(out io.Writer, timeout time.Duration) *FallbackGenerator {
+	if timeout <= 0 {
+		timeout = DefaultFallbackTimeout
+	}
+	return &FallbackGenerator{timeout: timeout, out: out}
+}
+
+// Add appends a generator that is tried after the ones added before it.
+func (f *FallbackGenerator) Add(name string, generator ContentGenerator) {
+	f.generators = append(f.generators, namedGenerator{name: name, generator: generator})
+}
+
+func (f *FallbackGenerator) GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error) {
+	return fallback(ctx, f, ai.KindTitle, func(ctx context.Context, g ContentGenerator) (string, error) {
+		return g.GeneratePRTitle(ctx, input)
+	}, validText, validText)
+}
+
+func (f *FallbackGenerator) GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error) {
+	return fallback(ctx, f, ai.KindDescription, func(ctx context.Context, g ContentGenerator) (string, error) {
+		return g.GeneratePRDescription(ctx, input)
+	}, validText, anyText)
+}
+
+func (f *FallbackGenerator) GenerateBranchName(ctx context.Context, input *ai.Input) (string, error) {
+	return fallback(ctx, f, ai.KindBranchName, func(ctx context.Context, g ContentGenerator) (string, error) {
+		return g.GenerateBranchName(ctx, input)
+	}, validText, anyText)
+}
+
+// GenerateContent asks each generator for a combined answer; one that cannot
+// be parsed is replaced by a request per field to the same generator before
+// the next generator is tried.
+func (f *FallbackGenerator) GenerateContent(ctx context.Context, input *ai.Input) (*ai.Content, error) {
+	return fallback(ctx, f, ai.KindContent, func(ctx context.Context, g ContentGenerator) (*ai.Content, error) {
+		content, err := g.GenerateContent(ctx, input)
+		if errors.Is(err, ai.ErrMalformedContent) {
+			fmt.Fprintf(f.out, "%s\n", color.YellowString("Could not parse the generated content, generating each part separately: %v", err))
+			return requestFields(ctx, g, input, f.out, contentKinds(input)...)
+		}
+		return content, err
+	}, func(content *ai.Content) error {
+		return validContent(content, input)
+	}, usableContent)
+}
+
+func (f *FallbackGenerator) Refine(ctx context.Context, kind ai.ContentKind, input *ai.Input, history []ai.Revision) (string, error) {
+	required := anyText
+	if kind == ai.KindTitle {
+		required = validText
+	}
+	return fallback(ctx, f, kind, func(ctx context.Context, g ContentGenerator) (string, error) {
+		return g.Refine(ctx, kind, input, history)
+	}, validText, required)
+}
+
+// fallback returns the first valid answer and reports which generator gave
+// it; the last generator's answer is checked with required instead. It stops
+// when ctx itself is done rather than trying the next one.
+func fallback[T any](ctx context.Context, f *FallbackGenerator, kind ai.ContentKind, generate func(context.Context, ContentGenerator) (T, error), validate, required func(T) error) (T, error) {
+	var zero T
+	var errs []error
+	for i, g := range f.generators {
+		last := i == len(f.generators)-1
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if !last {
+			attemptCtx, cancel = context.WithTimeout(ctx, f.timeout)
+		}
+		value, err := generate(attemptCtx, g.generator)
+		cancel()
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		if err == nil && !last {
+			err = validate(value)
+		} else if err == nil {
+			err = required(value)
+		}
+		if err == nil {
+			reportSource(ctx, kind, g.name)
+			return value, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", g.name, err))
+		if !last {
+			fmt.Fprintf(f.out, "%s\n", color.YellowString("%s could not generate the %s, trying %s: %v", g.name, kind, f.generators[i+1].name, err))
+		}
+	}
+	return zero, fmt.Errorf("no generator could generate the %s: %w", kind, errors.Join(errs...))
+}
+
+func validText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errEmptyAnswer
+	}
+	return nil
+}
+
+func anyText(string) error {
+	return nil
+}
+
+// validContent checks the fields ParseContent requires, for generators that
+// do not parse their answer.
+func validContent(content *ai.Content, input *ai.Input) error {
+	if content == nil || strings.TrimSpace(content.Title) == "" || strings.TrimSpace(content.Description) == "" ||
+		(input.Branch == "" && strings.TrimSpace(content.BranchName) == "") {
+		return fmt.Errorf("%w: missing fields", ai.ErrMalformedContent)
+	}
+	return nil
+}
+
+// usableContent checks the last resort's combined answer, which only needs
+// a title.
+func usableContent(content *ai.Content) error {
+	if content == nil || strings.TrimSpace(content.Title) == "" {
+		return fmt.Errorf("%w: missing title", ai.ErrMalformedContent)
+	}
+	return nil
+}
+
+type sourcesKey struct{}
+
+// contentSources collects which generator produced each kind of content,
+// for the requests made with the context returned by withSources.
+type contentSources struct {
+	mu     sync.Mutex
+	byKind map[ai.ContentKind]string
+}
+
+func withSources(ctx context.Context) (context.Context, *contentSources) {
+	sources := &contentSources{byKind: map[ai.ContentKind]string{}}
+	return context.WithValue(ctx, sourcesKey{}, sources), sources
+}
+
+// reportSource records name as the source of kind; a combined answer is
+// the source of every field in it.
+func reportSource(ctx context.Context, kind ai.ContentKind, name string) {
+	sources, ok := ctx.Value(sourcesKey{}).(*contentSources)
+	if !ok {
+		return
+	}
+	sources.mu.Lock()
+	defer sources.mu.Unlock()
+	if kind == ai.KindContent {
+		for _, kind := range []ai.ContentKind{ai.KindBranchName, ai.KindTitle, ai.KindDescription} {
+			sources.byKind[kind] = name
+		}
+		return
+	}
+	sources.byKind[kind] = name
+}
+
+// fields returns the sources keyed like the fields of GeneratedContent,
+// leaving out the branch name unless withBranch is set.
+func (s *contentSources) fields(withBranch bool) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := map[string]string{}
+	for kind, field := range map[ai.ContentKind]string{ai.KindBranchName: "branch_name", ai.KindTitle: "title", ai.KindDescription: "description"} {
+		if name, ok := s.byKind[kind]; ok && (withBranch || kind != ai.KindBranchName) {
+			fields[field] = name
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// describe lists the sources as "title yandex, description local", leaving
+// out the branch name unless withBranch is set.
+func (s *contentSources) describe(withBranch bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var parts []string
+	for _, kind := range []ai.ContentKind{ai.KindBranchName, ai.KindTitle, ai.KindDescription} {
+		if name, ok := s.byKind[kind]; ok && (withBranch || kind != ai.KindBranchName) {
+			parts = append(parts, fmt.Sprintf("%s %s", kind, name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,180 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+)
+
+// slowGenerator answers titles only once ctx is done.
+type slowGenerator struct {
+	*fakeGenerator
+}
+
+func (g slowGenerator) GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestFallbackGenerator(t *testing.T) {
+	failing, empty, working := newFakeGenerator(), newFakeGenerator(), newFakeGenerator()
+	failing.errs["GeneratePRTitle"] = errors.New("service unavailable")
+	empty.title = "  "
+	working.title = "Add cache"
+
+	var out bytes.Buffer
+	chain := NewFallbackGenerator(&out, time.Second)
+	chain.Add("yandex", failing)
+	chain.Add("openai", empty)
+	chain.Add("local", working)
+
+	ctx, sources := withSources(context.Background())
+	title, err := chain.GeneratePRTitle(ctx, &ai.Input{})
+	if err != nil || title != "Add cache" {
+		t.Fatalf("expected the title of the first valid generator, got %q: %v", title, err)
+	}
+	if failing.calls != 1 || empty.calls != 1 || working.calls != 1 {
+		t.Errorf("expected each generator to be tried once, got %d, %d and %d", failing.calls, empty.calls, working.calls)
+	}
+	for _, want := range []string{"yandex could not generate the title, trying openai: service unavailable", "openai could not generate the title, trying local: empty answer"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the output, got %q", want, out.String())
+		}
+	}
+	if got := sources.describe(true); got != "title local" {
+		t.Errorf("expected the source of the title, got %q", got)
+	}
+
+	description, err := chain.GeneratePRDescription(ctx, &ai.Input{})
+	if err != nil || description != "Adds a cache for responses." {
+		t.Errorf("expected the first generator's description, got %q: %v", description, err)
+	}
+	if got := sources.fields(false); got["title"] != "local" || got["description"] != "yandex" {
+		t.Errorf("unexpected sources: %v", got)
+	}
+}
+
+func TestFallbackGenerator_timeout(t *testing.T) {
+	chain := NewFallbackGenerator(&bytes.Buffer{}, 20*time.Millisecond)
+	chain.Add("yandex", slowGenerator{newFakeGenerator()})
+	chain.Add("local", newFakeGenerator())
+
+	title, err := chain.GeneratePRTitle(context.Background(), &ai.Input{})
+	if err != nil || title != "Add response cache" {
+		t.Errorf("expected the next generator after the timeout, got %q: %v", title, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	local := newFakeGenerator()
+	chain = NewFallbackGenerator(&bytes.Buffer{}, time.Second)
+	chain.Add("yandex", slowGenerator{newFakeGenerator()})
+	chain.Add("local", local)
+	if _, err := chain.GeneratePRTitle(ctx, &ai.Input{}); !errors.Is(err, context.Canceled) || local.calls != 0 {
+		t.Errorf("expected cancellation to stop the chain, got %v after %d calls", err, local.calls)
+	}
+}
+
+func TestFallbackGenerator_lastResort(t *testing.T) {
+	malformed, local := newFakeGenerator(), newFakeGenerator()
+	malformed.errs["GenerateContent"] = fmt.Errorf("%w: no JSON object", ai.ErrMalformedContent)
+	malformed.title = ""
+	local.description = ""
+
+	chain := NewFallbackGenerator(&bytes.Buffer{}, time.Second)
+	chain.Add("yandex", malformed)
+	chain.Add("local", local)
+	content, err := chain.GenerateContent(context.Background(), &ai.Input{Branch: "feature"})
+	if err != nil || content.Title != "Add response cache" || content.Description != "" {
+		t.Errorf("expected the last generator's answer without a description, got %+v: %v", content, err)
+	}
+
+	local.title = ""
+	_, err = chain.GenerateContent(context.Background(), &ai.Input{Branch: "feature"})
+	if !errors.Is(err, ai.ErrMalformedContent) || !strings.Contains(err.Error(), "local: malformed content: missing title") {
+		t.Errorf("expected the last generator's answer without a title to be rejected, got %v", err)
+	}
+	if _, err := chain.GeneratePRTitle(context.Background(), &ai.Input{}); err == nil || !strings.Contains(err.Error(), "no generator could generate the title") {
+		t.Errorf("expected an empty last resort title to fail, got %v", err)
+	}
+
+	local.errs["GenerateContent"] = errors.New("no commits")
+	_, err = chain.GenerateContent(context.Background(), &ai.Input{Branch: "feature"})
+	if !errors.Is(err, ai.ErrMalformedContent) || !strings.Contains(err.Error(), "local: no commits") {
+		t.Errorf("expected the errors of every generator, got %v", err)
+	}
+}
+
+func TestFallbackGenerator_GenerateContent_separateRequests(t *testing.T) {
+	malformed, local := newFakeGenerator(), newFakeGenerator()
+	malformed.errs["GenerateContent"] = fmt.Errorf("%w: no JSON object", ai.ErrMalformedContent)
+	malformed.title = "Cache responses"
+
+	var out bytes.Buffer
+	chain := NewFallbackGenerator(&out, time.Second)
+	chain.Add("yandex", malformed)
+	chain.Add("local", local)
+	ctx, sources := withSources(context.Background())
+	content, err := chain.GenerateContent(ctx, &ai.Input{})
+	if err != nil || content.Title != "Cache responses" || content.BranchName != "add-response-cache" {
+		t.Fatalf("expected separate answers of the same generator, got %+v: %v", content, err)
+	}
+	if malformed.calls != 4 || local.calls != 0 {
+		t.Errorf("expected the combined and three separate requests to yandex only, got %d and %d", malformed.calls, local.calls)
+	}
+	if got := sources.describe(true); got != "branch name yandex, title yandex, description yandex" {
+		t.Errorf("unexpected sources %q", got)
+	}
+	if !strings.Contains(out.String(), "generating each part separately") {
+		t.Errorf("expected the separate requests to be reported, got %q", out.String())
+	}
+}
+
+func TestService_Run_emptyLastResortTitle(t *testing.T) {
+	failing, local := newFakeGenerator(), newFakeGenerator()
+	failing.errs["GenerateContent"] = errors.New("service unavailable")
+	failing.errs["GeneratePRTitle"] = errors.New("service unavailable")
+	local.title = ""
+	chain := NewFallbackGenerator(&bytes.Buffer{}, time.Second)
+	chain.Add("yandex", failing)
+	chain.Add("local", local)
+
+	gitRepo, provider := newFakeGit("main"), newFakeProvider()
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, local, provider)
+	s.generator = chain
+	if _, err := s.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "no generator could generate the title") {
+		t.Fatalf("expected the run to fail without a title, got %v", err)
+	}
+	if len(gitRepo.pushed) != 0 || len(provider.pullRequests) != 0 {
+		t.Errorf("expected nothing to be pushed or created, got %v and %v", gitRepo.pushed, provider.pullRequests)
+	}
+}
+
+func TestService_Run_fallbackSources(t *testing.T) {
+	failing, local := newFakeGenerator(), newFakeGenerator()
+	failing.errs["GenerateContent"] = errors.New("service unavailable")
+	chain := NewFallbackGenerator(&bytes.Buffer{}, time.Second)
+	chain.Add("yandex", failing)
+	chain.Add("local", local)
+
+	s := newTestService(&config.Config{DryRun: true}, newFakeGit("main"), local, newFakeProvider())
+	s.generator = chain
+	result, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"branch_name": "local", "title": "local", "description": "local"}
+	if fmt.Sprint(result.Generated.Sources) != fmt.Sprint(want) {
+		t.Errorf("expected sources %v, got %v", want, result.Generated.Sources)
+	}
+	if !strings.Contains(s.out.(*bytes.Buffer).String(), "Generated by: branch name local, title local, description local") {
+		t.Errorf("expected the sources to be reported, got %q", s.out.(*bytes.Buffer).String())
+	}
+}
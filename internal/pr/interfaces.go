@@ -3,16 +3,51 @@ package pr
 import (
 	"context"
 
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/git"
+	"github.com/deck/branchtale/internal/tracker"
 	"github.com/deck/branchtale/internal/vcs"
 )
 
 type ContentGenerator interface {
-	GeneratePRTitle(ctx context.Context, diff string) (string, error)
-	GeneratePRDescription(ctx context.Context, diff string) (string, error)
-	GenerateBranchName(ctx context.Context, diff string) (string, error)
+	GeneratePRTitle(ctx context.Context, input *ai.Input) (string, error)
+	GeneratePRDescription(ctx context.Context, input *ai.Input) (string, error)
+	GenerateBranchName(ctx context.Context, input *ai.Input) (string, error)
+	// GenerateContent generates the branch name, if input has no branch yet,
+	// the title, the description and labels in a single request.
+	GenerateContent(ctx context.Context, input *ai.Input) (*ai.Content, error)
+	Refine(ctx context.Context, kind ai.ContentKind, input *ai.Input, history []ai.Revision) (string, error)
+}
+
+type IssueTracker interface {
+	FetchIssue(ctx context.Context, key string) (*tracker.Issue, error)
+	IssueURL(key string) string
 }
 
 type VCSProvider interface {
 	CreatePullRequest(ctx context.Context, req *vcs.CreatePullRequestRequest) (*vcs.CreatePullRequestResponse, error)
 	MergePullRequest(ctx context.Context, req *vcs.MergePullRequestRequest) (*vcs.MergePullRequestResponse, error)
+	FindPullRequest(ctx context.Context, req *vcs.FindPullRequestRequest) (*vcs.PullRequest, error)
+	UpdatePullRequest(ctx context.Context, req *vcs.UpdatePullRequestRequest) error
+}
+
+type GitRepository interface {
+	GetInfo() (*git.RepoInfo, error)
+	GetRemoteUrl(ctx context.Context, name string) (string, error)
+	GetDiffBetweenBranches(ctx context.Context, remote, remoteBranch, localBranch string) (*git.DiffInfo, error)
+	CreateBranch(ctx context.Context, branchName string) error
+	CheckoutBranch(ctx context.Context, branchName string) error
+	BranchExistsOnRemote(ctx context.Context, branchName, remoteName string) (bool, error)
+	ListRemoteBranches(ctx context.Context, remoteName string) ([]string, error)
+	PushBranch(ctx context.Context, branchName, remoteName string) error
+	DeleteBranch(ctx context.Context, branchName string) error
+	DeleteRemoteBranch(ctx context.Context, branchName, remoteName string) error
+	ResolveRevision(ctx context.Context, revision string) (string, error)
+	IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error)
+	ResetBranch(ctx context.Context, branchName, commit string) error
+	ListBranches(ctx context.Context) ([]string, error)
+	Fetch(ctx context.Context, remoteName string) error
+	Rebase(ctx context.Context, onto, upstream, branch string) error
+	GetCommitChanges(ctx context.Context, hash string) (*git.CommitChanges, error)
+	CherryPickBranch(ctx context.Context, branchName, base string, commits []string) error
 }
@@ -32,6 +32,24 @@ func (p *Prompter) YesNo(prompt string) bool {
 	return response == "y" || response == "yes"
 }
 
+func (p *Prompter) YesNoWithDefault(prompt string, defaultValue bool) bool {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	options := "y/N"
+	if defaultValue {
+		options = "Y/n"
+	}
+	fmt.Fprintf(p.writer, "%s (%s): ", cyan(prompt), options)
+	response, err := p.reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response == "" {
+		return defaultValue
+	}
+	return response == "y" || response == "yes"
+}
+
 func (p *Prompter) Input(prompt string) (string, error) {
 	cyan := color.New(color.FgCyan).SprintFunc()
 	fmt.Fprintf(p.writer, "%s: ", cyan(prompt))
@@ -63,3 +81,26 @@ func (p *Prompter) InputWithDefault(prompt, defaultValue string) (string, error)
 
 	return input, nil
 }
+
+func (p *Prompter) Choose(prompt string, options []string, defaultOption string) (string, error) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	bold := color.New(color.Bold).SprintFunc()
+	for {
+		fmt.Fprintf(p.writer, "%s [%s] (%s): ", cyan(prompt), strings.Join(options, "/"), bold(defaultOption))
+		input, err := p.reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			return defaultOption, nil
+		}
+		for _, option := range options {
+			if input == option {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(p.writer, "Please enter one of: %s\n", strings.Join(options, ", "))
+	}
+}
@@ -27,6 +27,16 @@ func TestPrompter_YesNo_no(t *testing.T) {
 	}
 }
 
+func TestPrompter_YesNoWithDefault(t *testing.T) {
+	p := NewPrompter(&bytes.Buffer{}, strings.NewReader("\nn\n"))
+	if !p.YesNoWithDefault("Reset?", true) {
+		t.Errorf("Expected empty input to return the default")
+	}
+	if p.YesNoWithDefault("Reset?", true) {
+		t.Errorf("Expected 'n' to override the default")
+	}
+}
+
 func TestPrompter_Input(t *testing.T) {
 	input := strings.NewReader("hello world\n")
 	output := &bytes.Buffer{}
@@ -68,3 +78,32 @@ func TestPrompter_InputWithDefault_userInput(t *testing.T) {
 		t.Errorf("Expected user input, got '%s'", val)
 	}
 }
+
+func TestPrompter_Choose(t *testing.T) {
+	input := strings.NewReader("x\nr\n")
+	output := &bytes.Buffer{}
+	p := NewPrompter(output, input)
+	val, err := p.Choose("Action", []string{"a", "r"}, "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if val != "r" {
+		t.Errorf("Expected 'r', got '%s'", val)
+	}
+	if !strings.Contains(output.String(), "Please enter one of") {
+		t.Errorf("Expected invalid choice to be reported")
+	}
+}
+
+func TestPrompter_Choose_default(t *testing.T) {
+	input := strings.NewReader("\n")
+	output := &bytes.Buffer{}
+	p := NewPrompter(output, input)
+	val, err := p.Choose("Action", []string{"a", "r"}, "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if val != "a" {
+		t.Errorf("Expected default 'a', got '%s'", val)
+	}
+}
@@ -0,0 +1,93 @@
+package pr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/deck/branchtale/internal/usage"
+)
+
+const (
+	StatusCompleted  = "completed"
+	StatusDryRun     = "dry_run"
+	StatusUpToDate   = "up_to_date"
+	StatusAborted    = "aborted"
+	StatusFailed     = "failed"
+	StatusRolledBack = "rolled_back"
+)
+
+type Result struct {
+	Status        string               `json:"status"`
+	Repository    string               `json:"repository,omitempty"`
+	BaseBranch    string               `json:"base_branch,omitempty"`
+	HeadBranch    string               `json:"head_branch,omitempty"`
+	DryRun        bool                 `json:"dry_run"`
+	BranchCreated bool                 `json:"branch_created"`
+	Pushed        bool                 `json:"pushed"`
+	BaseReset     bool                 `json:"base_reset"`
+	PullRequest   *PullRequestResult   `json:"pull_request,omitempty"`
+	Merge         *MergeResult         `json:"merge,omitempty"`
+	Generated     *GeneratedContent    `json:"generated,omitempty"`
+	Plan          *Requirements        `json:"plan,omitempty"`
+	Stack         []*StackBranchResult `json:"stack,omitempty"`
+	Split         []*SplitGroupResult  `json:"split,omitempty"`
+	Timings       map[string]int64     `json:"timings_ms"`
+	Usage         *usage.Summary       `json:"usage,omitempty"`
+	Error         string               `json:"error,omitempty"`
+}
+
+type PullRequestResult struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+type MergeResult struct {
+	Merged  bool   `json:"merged"`
+	SHA     string `json:"sha,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// GeneratedContent is what was generated. Sources names the backend that
+// produced each field when several are configured.
+type GeneratedContent struct {
+	BranchName  string            `json:"branch_name,omitempty"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Labels      []string          `json:"labels,omitempty"`
+	Sources     map[string]string `json:"sources,omitempty"`
+}
+
+func newResult(dryRun bool) *Result {
+	return &Result{
+		DryRun:  dryRun,
+		Timings: map[string]int64{},
+	}
+}
+
+func WritePlan(path string, r *Requirements) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+func ReadPlan(path string) (*Requirements, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var r Requirements
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	if r.BaseBranch == "" || r.BranchName == "" {
+		return nil, fmt.Errorf("invalid plan %s: base and head branches are required", path)
+	}
+	return &r, nil
+}
@@ -0,0 +1,41 @@
+package pr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlan_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	plan := &Requirements{
+		CreateBranch:           true,
+		PushBranch:             true,
+		BranchName:             "feature/add-cache",
+		BaseBranch:             "main",
+		CreatePullRequest:      true,
+		PullRequestTitle:       "Add response cache",
+		PullRequestDescription: "Caches responses.",
+	}
+
+	if err := WritePlan(path, plan); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	loaded, err := ReadPlan(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.BranchName != plan.BranchName || loaded.PullRequestTitle != plan.PullRequestTitle || !loaded.CreateBranch || loaded.MergePullRequest {
+		t.Errorf("Plan did not round-trip: %+v", loaded)
+	}
+}
+
+func TestReadPlan_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(path, []byte(`{"base_branch": "main"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPlan(path); err == nil {
+		t.Error("Expected error for plan without head branch")
+	}
+}
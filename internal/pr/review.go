@@ -0,0 +1,205 @@
+package pr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/cache"
+	"github.com/fatih/color"
+)
+
+var errAborted = errors.New("aborted by user")
+
+func (s *Service) review(ctx context.Context, generator ContentGenerator, input *ai.Input, r *Requirements) error {
+	history := map[ai.ContentKind][]ai.Revision{}
+	for {
+		printProposal(s.out, r)
+
+		action, err := s.prompter.Choose("Accept (a), regenerate (r), regenerate with instructions (i), edit (e), edit description in $EDITOR (d) or quit (q)?", []string{"a", "r", "i", "e", "d", "q"}, "a")
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "a":
+			return nil
+		case "r":
+			if err := s.regenerate(ctx, generator, input, r); err != nil {
+				return err
+			}
+		case "i":
+			if err := s.refine(ctx, generator, input, r, history); err != nil {
+				return err
+			}
+		case "e":
+			if err := s.editInline(ctx, r); err != nil {
+				return err
+			}
+		case "d":
+			description, err := editInEditor(r.PullRequestDescription)
+			if err != nil {
+				return err
+			}
+			r.PullRequestDescription = description
+		case "q":
+			return errAborted
+		}
+	}
+}
+
+func (s *Service) regenerate(ctx context.Context, generator ContentGenerator, input *ai.Input, r *Requirements) error {
+	prompt := "Regenerate title (t), description (d) or all (a)?"
+	options := []string{"t", "d", "a"}
+	if r.CreateBranch {
+		prompt = "Regenerate title (t), description (d), branch (b) or all (a)?"
+		options = append(options, "b")
+	}
+
+	target, err := s.prompter.Choose(prompt, options, "a")
+	if err != nil {
+		return err
+	}
+
+	var kinds []ai.ContentKind
+	if r.CreateBranch && (target == "b" || target == "a") {
+		kinds = append(kinds, ai.KindBranchName)
+	}
+	if target == "t" || target == "a" {
+		kinds = append(kinds, ai.KindTitle)
+	}
+	if target == "d" || target == "a" {
+		kinds = append(kinds, ai.KindDescription)
+	}
+
+	content, err := s.generateFields(cache.Refresh(ctx), generator, input, kinds...)
+	if err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		switch kind {
+		case ai.KindBranchName:
+			r.BranchName = content.BranchName
+		case ai.KindTitle:
+			r.PullRequestTitle = content.Title
+		case ai.KindDescription:
+			r.PullRequestDescription = content.Description
+		}
+	}
+	return nil
+}
+
+// refine sends the current value and the user's feedback back to the model.
+// history keeps every round per field so later instructions build on earlier ones.
+func (s *Service) refine(ctx context.Context, generator ContentGenerator, input *ai.Input, r *Requirements, history map[ai.ContentKind][]ai.Revision) error {
+	prompt := "Refine title (t) or description (d)?"
+	options := []string{"t", "d"}
+	if r.CreateBranch {
+		prompt = "Refine title (t), description (d) or branch (b)?"
+		options = append(options, "b")
+	}
+
+	target, err := s.prompter.Choose(prompt, options, "t")
+	if err != nil {
+		return err
+	}
+
+	var kind ai.ContentKind
+	var field *string
+	current := ""
+	switch target {
+	case "t":
+		kind, field, current = ai.KindTitle, &r.PullRequestTitle, r.PullRequestTitle
+	case "d":
+		kind, field, current = ai.KindDescription, &r.PullRequestDescription, r.PullRequestDescription
+	case "b":
+		kind, field, current = ai.KindBranchName, &r.BranchName, s.branchSlug(r.BranchName, input)
+	}
+
+	feedback, err := s.prompter.Input(fmt.Sprintf("What should change in the %s", kind))
+	if err != nil {
+		return err
+	}
+	if feedback == "" {
+		return nil
+	}
+
+	history[kind] = append(history[kind], ai.Revision{Output: current, Feedback: feedback})
+	refined, err := generator.Refine(ctx, kind, input, history[kind])
+	if err != nil {
+		return fmt.Errorf("failed to refine %s: %w", kind, err)
+	}
+
+	switch kind {
+	case ai.KindTitle:
+		refined, err = s.formatTitle(refined, input)
+		if err != nil {
+			return err
+		}
+	case ai.KindDescription:
+		refined = s.withTicketLink(refined, input)
+	case ai.KindBranchName:
+		refined, err = s.branchName(ctx, refined, input, nil)
+		if err != nil {
+			return err
+		}
+	}
+	*field = refined
+	return nil
+}
+
+func (s *Service) editInline(ctx context.Context, r *Requirements) error {
+	if r.CreateBranch {
+		branchName, err := s.prompter.InputWithDefault("Branch", r.BranchName)
+		if err != nil {
+			return err
+		}
+		if branchName != r.BranchName {
+			if branchName, err = s.availableBranchName(ctx, branchName, nil); err != nil {
+				fmt.Fprintln(s.out, color.YellowString("%v; keeping %s", err, r.BranchName))
+			} else {
+				r.BranchName = branchName
+			}
+		}
+	}
+
+	title, err := s.prompter.InputWithDefault("Title", r.PullRequestTitle)
+	if err != nil {
+		return err
+	}
+	if err := s.checkTitle(title); err != nil {
+		fmt.Fprintln(s.out, color.YellowString("%v; keeping %s", err, r.PullRequestTitle))
+		return nil
+	}
+	r.PullRequestTitle = title
+	return nil
+}
+
+func (s *Service) confirm(r *Requirements) bool {
+	if r.PushBranch && !s.prompter.YesNo(fmt.Sprintf("Push branch %s to origin?", r.BranchName)) {
+		return false
+	}
+	if r.CreatePullRequest && !s.prompter.YesNo(fmt.Sprintf("Create pull request from %s into %s?", r.BranchName, r.BaseBranch)) {
+		return false
+	}
+	if r.MergePullRequest && !s.prompter.YesNo("Merge the pull request right after it is created?") {
+		r.MergePullRequest = false
+	}
+	if r.CreateBranch && r.ResetBase {
+		r.ResetBase = s.prompter.YesNoWithDefault(fmt.Sprintf("Move local %s back to origin/%s once the branch is pushed?", r.BaseBranch, r.BaseBranch), true)
+	}
+	return true
+}
+
+func printProposal(w io.Writer, r *Requirements) {
+	bold := color.New(color.Bold).SprintFunc()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, bold("Proposed pull request"))
+	fmt.Fprintf(w, "%s %s\n", bold("Branch:"), color.GreenString(r.BranchName))
+	fmt.Fprintf(w, "%s %s\n", bold("Title:"), color.GreenString(r.PullRequestTitle))
+	fmt.Fprintln(w, bold("Description:"))
+	fmt.Fprintln(w, r.PullRequestDescription)
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,121 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+)
+
+func newReviewService(input string) *Service {
+	return &Service{
+		config:   &config.Config{BranchPrefix: "feature/"},
+		git:      newFakeGit("main"),
+		prompter: NewPrompter(&bytes.Buffer{}, strings.NewReader(input)),
+		out:      &bytes.Buffer{},
+	}
+}
+
+func TestService_review_regenerateThenEdit(t *testing.T) {
+	s := newReviewService("r\nb\ne\n\nEdited title\na\n")
+	generator := newFakeGenerator()
+	r := &Requirements{
+		CreateBranch:     true,
+		BranchName:       "feature/original",
+		PullRequestTitle: "Original title",
+	}
+
+	if err := s.review(context.Background(), generator, &ai.Input{Diff: "diff"}, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.BranchName != "feature/add-response-cache" {
+		t.Errorf("Expected regenerated branch with prefix, got '%s'", r.BranchName)
+	}
+	if r.PullRequestTitle != "Edited title" {
+		t.Errorf("Expected edited title, got '%s'", r.PullRequestTitle)
+	}
+	if generator.calls != 1 {
+		t.Errorf("Expected only the branch to be regenerated, got %d calls", generator.calls)
+	}
+}
+
+func TestService_review_quit(t *testing.T) {
+	s := newReviewService("q\n")
+	err := s.review(context.Background(), newFakeGenerator(), &ai.Input{Diff: "diff"}, &Requirements{})
+	if !errors.Is(err, errAborted) {
+		t.Errorf("Expected errAborted, got %v", err)
+	}
+}
+
+func TestService_review_refineBranchSlug(t *testing.T) {
+	s := newReviewService("i\nb\nMention the cache\na\n")
+	s.config.BranchTemplate = "{type}/{ticket}-{slug}"
+	generator := newFakeGenerator()
+	input := &ai.Input{Diff: "diff", Commits: []string{"fix: handle empty cache"}, Ticket: "ABC-7"}
+	r := &Requirements{CreateBranch: true, BranchName: "feature/fix/ABC-7-empty-cache"}
+
+	if err := s.review(context.Background(), generator, input, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(generator.history) != 1 || generator.history[0].Output != "empty-cache" {
+		t.Errorf("expected only the slug to be sent for refinement, got %+v", generator.history)
+	}
+	if r.BranchName != "feature/fix/ABC-7-refined-branch-name-1" {
+		t.Errorf("expected the refined slug in the template, got %q", r.BranchName)
+	}
+}
+
+func TestService_confirm_declineMerge(t *testing.T) {
+	s := newReviewService("y\ny\nn\n")
+	r := &Requirements{PushBranch: true, CreatePullRequest: true, MergePullRequest: true}
+	if !s.confirm(r) {
+		t.Fatal("Expected confirmation to succeed")
+	}
+	if r.MergePullRequest {
+		t.Error("Expected merge to be skipped")
+	}
+}
+
+func TestService_confirm_declinePush(t *testing.T) {
+	s := newReviewService("n\n")
+	if s.confirm(&Requirements{PushBranch: true, CreatePullRequest: true}) {
+		t.Error("Expected confirmation to be declined")
+	}
+}
+
+func TestService_confirm_resetBaseDefaultsToYes(t *testing.T) {
+	s := newReviewService("y\ny\n\n")
+	r := &Requirements{CreateBranch: true, PushBranch: true, CreatePullRequest: true, ResetBase: true, BaseBranch: "main"}
+	if !s.confirm(r) {
+		t.Fatal("Expected confirmation to succeed")
+	}
+	if !r.ResetBase {
+		t.Error("Expected base reset to stay enabled")
+	}
+}
+
+func TestService_review_refineKeepsHistory(t *testing.T) {
+	s := newReviewService("i\nt\nMention the cache\ni\nt\nShorter please\na\n")
+	generator := newFakeGenerator()
+	r := &Requirements{PullRequestTitle: "Original title"}
+
+	if err := s.review(context.Background(), generator, &ai.Input{Diff: "diff"}, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.PullRequestTitle != "Refined title #2" {
+		t.Errorf("Expected refined title, got '%s'", r.PullRequestTitle)
+	}
+	if len(generator.history) != 2 {
+		t.Fatalf("Expected 2 revisions in history, got %d", len(generator.history))
+	}
+	if generator.history[0].Output != "Original title" || generator.history[0].Feedback != "Mention the cache" {
+		t.Errorf("Unexpected first revision: %+v", generator.history[0])
+	}
+	if generator.history[1].Output != "Refined title #1" || generator.history[1].Feedback != "Shorter please" {
+		t.Errorf("Unexpected second revision: %+v", generator.history[1])
+	}
+}
@@ -2,157 +2,368 @@ package pr
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/deck/branchtale/internal/ai"
 	"github.com/deck/branchtale/internal/config"
 	"github.com/deck/branchtale/internal/git"
 	"github.com/fatih/color"
+	"golang.org/x/sync/errgroup"
 )
 
 type Service struct {
-	config *config.Config
+	config    *config.Config
+	git       GitRepository
+	generator ContentGenerator
+	vcs       VCSProvider
+	state     StateStore
+	tracker   IssueTracker
+	prompter  *Prompter
+	out       io.Writer
 }
 
-func NewService(cfg *config.Config) *Service {
-	return &Service{
-		config: cfg,
+func NewService(cfg *config.Config, gitRepo GitRepository, generator ContentGenerator, vcsProvider VCSProvider, stateStore StateStore) *Service {
+	s := &Service{
+		config:    cfg,
+		git:       gitRepo,
+		generator: generator,
+		vcs:       vcsProvider,
+		state:     stateStore,
+		out:       os.Stdout,
 	}
+	if cfg.Output == config.OutputJSON {
+		s.out = os.Stderr
+	}
+	if cfg.Interactive {
+		s.prompter = NewPrompter(s.out, os.Stdin)
+	}
+	return s
 }
 
-func (s *Service) Run(ctx context.Context) error {
-	gitRepo, generator, err := s.initializeServices()
-	if err != nil {
-		return err
-	}
+// SetIssueTracker enables ticket links to, and issue lookups in, a tracker.
+func (s *Service) SetIssueTracker(t IssueTracker) {
+	s.tracker = t
+}
 
-	if s.config.Verbose {
-		fmt.Println("Services initialized successfully")
+func (s *Service) Run(ctx context.Context) (*Result, error) {
+	started := time.Now()
+	result := newResult(s.config.DryRun)
+	defer func() { result.Timings["total"] = time.Since(started).Milliseconds() }()
+
+	gitRepo, generator := s.git, s.generator
+	ctx = ai.WithStreamOutput(ctx, s.out)
+	ctx, sources := withSources(ctx)
+
+	if !s.config.DryRun {
+		state, err := s.state.Load()
+		if err != nil {
+			return result, err
+		}
+		if state != nil {
+			return result, s.resume(ctx, state, result)
+		}
 	}
 
 	repoInfo, err := gitRepo.GetInfo()
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	fmt.Printf("Current branch: %s\n", color.GreenString(repoInfo.CurrentBranch))
+	fmt.Fprintf(s.out, "Current branch: %s\n", color.GreenString(repoInfo.CurrentBranch))
 	r := &Requirements{
 		BaseBranch: repoInfo.MainBranch,
 	}
+	result.BaseBranch = repoInfo.MainBranch
+	result.HeadBranch = repoInfo.CurrentBranch
+
+	// The remote branch check runs while the content is generated; a failure
+	// of either cancels the other.
+	checks, generationCtx := errgroup.WithContext(ctx)
+	defer checks.Wait()
+	var branchOnRemote bool
 
 	var diffInfo *git.DiffInfo
+	var input *ai.Input
 	if repoInfo.IsOnMain {
 		diffInfo, err = gitRepo.GetDiffBetweenBranches(ctx, "origin", repoInfo.MainBranch, repoInfo.MainBranch)
 		if err != nil {
-			return fmt.Errorf("failed to get local commits ahead of origin: %w", err)
+			return result, fmt.Errorf("failed to get local commits ahead of origin: %w", err)
 		}
 
 		if len(diffInfo.Commits) == 0 {
-			color.Blue("Your branch is up to date with origin/%s. Nothing to do.\n", repoInfo.MainBranch)
-			return nil
+			fmt.Fprintln(s.out, color.BlueString("Your branch is up to date with origin/%s. Nothing to do.", repoInfo.MainBranch))
+			result.Status = StatusUpToDate
+			return result, nil
 		}
 
 		if s.config.Verbose {
-			fmt.Printf("Found %s local commit(s) ahead of origin:\n", color.New(color.Bold).Sprintf("%d", len(diffInfo.Commits)))
+			fmt.Fprintf(s.out, "Found %s local commit(s) ahead of origin:\n", color.New(color.Bold).Sprintf("%d", len(diffInfo.Commits)))
 			for i, commit := range diffInfo.Commits {
-				fmt.Printf("  %d. %s - %s\n", i+1, color.YellowString(commit.Hash.String()[:8]), strings.TrimSpace(commit.Message))
+				fmt.Fprintf(s.out, "  %d. %s - %s\n", i+1, color.YellowString(commit.Hash.String()[:8]), strings.TrimSpace(commit.Message))
 			}
 
-			fmt.Println("These changes will be used to generate the branch name, PR title, and description.")
-			fmt.Printf("Diff summary:\n%s\n", color.YellowString(diffInfo.Diff))
+			fmt.Fprintln(s.out, "These changes will be used to generate the branch name, PR title, and description.")
+			fmt.Fprintf(s.out, "Diff summary:\n%s\n", color.YellowString(diffInfo.Diff))
 		}
 
-		fmt.Println("Generating a feature branch name for these changes...")
-		branchName, err := generator.GenerateBranchName(ctx, diffInfo.Diff)
-		if err != nil {
-			return fmt.Errorf("failed to generate branch name: %w", err)
-		}
-		if s.config.BranchPrefix != "" {
-			branchName = s.config.BranchPrefix + branchName
-		}
-		fmt.Printf("Suggested branch: %s\n", color.GreenString(branchName))
+		input = s.contentInput(ctx, diffInfo, "")
+
+		fmt.Fprintln(s.out, "Generating a feature branch name, title and description for these changes...")
 		r.CreateBranch = true
-		r.BranchName = branchName
 		r.PushBranch = true
+		r.ResetBase = s.config.ResetBase || s.config.Interactive
 	} else {
 		if s.config.Verbose {
-			fmt.Println("You are already on a feature branch.")
+			fmt.Fprintln(s.out, "You are already on a feature branch.")
 		}
+		r.BranchName = repoInfo.CurrentBranch
+		checks.Go(func() error {
+			exists, err := gitRepo.BranchExistsOnRemote(generationCtx, repoInfo.CurrentBranch, "origin")
+			if err != nil {
+				return fmt.Errorf("failed to check remote branch: %w", err)
+			}
+			branchOnRemote = exists
+			return nil
+		})
 
-		branchOnRemote, err := gitRepo.BranchExistsOnRemote(ctx, repoInfo.CurrentBranch, "origin")
+		parent, err := s.stackParent(ctx, repoInfo.CurrentBranch, repoInfo.MainBranch)
 		if err != nil {
-			return fmt.Errorf("failed to check remote branch: %w", err)
+			if !s.config.DryRun {
+				return result, fmt.Errorf("failed to look for a parent branch: %w", err)
+			}
+			fmt.Fprintf(s.out, "%s\n", color.YellowString("Could not look for a parent branch, assuming %s: %v", repoInfo.MainBranch, err))
 		}
-		if !branchOnRemote {
-			r.PushBranch = true
-			fmt.Printf("Branch %s does not exist on remote. It will be pushed.\n", color.YellowString(repoInfo.CurrentBranch))
+		if parent != nil {
+			r.BaseBranch = parent.HeadBranch
+			result.BaseBranch = parent.HeadBranch
+			fmt.Fprintf(s.out, "Stacked on %s (#%d). The pull request will target it and will not be merged.\n", color.GreenString(parent.HeadBranch), parent.Number)
 		}
 
-		diffInfo, err = gitRepo.GetDiffBetweenBranches(ctx, "origin", repoInfo.MainBranch, repoInfo.CurrentBranch)
+		diffInfo, err = gitRepo.GetDiffBetweenBranches(ctx, "origin", r.BaseBranch, repoInfo.CurrentBranch)
 		if err != nil {
-			return fmt.Errorf("failed to get diff from origin/master: %w", err)
+			return result, fmt.Errorf("failed to get diff from origin/%s: %w", r.BaseBranch, err)
 		}
+		input = s.contentInput(ctx, diffInfo, repoInfo.CurrentBranch)
 	}
 
-	title, err := generator.GeneratePRTitle(ctx, diffInfo.Diff)
-	if err != nil {
-		return fmt.Errorf("failed to generate PR title: %w", err)
+	generationStarted := time.Now()
+	content, err := s.generateContent(generationCtx, generator, input)
+	if checkErr := checks.Wait(); checkErr != nil {
+		return result, checkErr
 	}
-	r.PullRequestTitle = title
-
-	description, err := generator.GeneratePRDescription(ctx, diffInfo.Diff)
 	if err != nil {
-		return fmt.Errorf("failed to generate PR description: %w", err)
+		return result, err
+	}
+	result.Timings["generate_content"] = time.Since(generationStarted).Milliseconds()
+	if !repoInfo.IsOnMain && !branchOnRemote {
+		r.PushBranch = true
+		fmt.Fprintf(s.out, "Branch %s does not exist on remote. It will be pushed.\n", color.YellowString(repoInfo.CurrentBranch))
+	}
+	if r.CreateBranch {
+		r.BranchName = content.BranchName
+		fmt.Fprintf(s.out, "Suggested branch: %s\n", color.GreenString(r.BranchName))
 	}
-	r.PullRequestDescription = description
+	if len(content.Labels) > 0 {
+		fmt.Fprintf(s.out, "Suggested labels: %s\n", color.CyanString(strings.Join(content.Labels, ", ")))
+	}
+	if described := sources.describe(r.CreateBranch); described != "" {
+		fmt.Fprintf(s.out, "Generated by: %s\n", described)
+	}
+	r.PullRequestTitle = content.Title
+	r.PullRequestDescription = content.Description
 	r.CreatePullRequest = true
-	r.MergePullRequest = true
-	return Execute(ctx, r, gitRepo, s.config)
+	r.MergePullRequest = r.BaseBranch == repoInfo.MainBranch
+
+	if s.prompter != nil {
+		if err := s.review(ctx, generator, input, r); err != nil {
+			if errors.Is(err, errAborted) {
+				fmt.Fprintln(s.out, color.YellowString("Aborted. Nothing was pushed."))
+				result.Status = StatusAborted
+				return result, nil
+			}
+			return result, err
+		}
+		if !s.config.DryRun && !s.confirm(r) {
+			fmt.Fprintln(s.out, color.YellowString("Aborted. Nothing was pushed."))
+			result.Status = StatusAborted
+			return result, nil
+		}
+	}
+
+	result.Generated = &GeneratedContent{
+		Title:       r.PullRequestTitle,
+		Description: r.PullRequestDescription,
+		Labels:      content.Labels,
+		Sources:     sources.fields(r.CreateBranch),
+	}
+	if r.CreateBranch {
+		result.Generated.BranchName = r.BranchName
+	}
+
+	if s.config.PlanOut != "" {
+		if err := WritePlan(s.config.PlanOut, r); err != nil {
+			return result, err
+		}
+		fmt.Fprintf(s.out, "Plan written to %s\n", color.GreenString(s.config.PlanOut))
+	}
+
+	return result, s.Execute(ctx, r, result)
 }
 
-func (s *Service) initializeServices() (*git.Repository, ContentGenerator, error) {
-	cwd, err := os.Getwd()
+// Apply executes a plan written earlier with --plan-out, without generating anything.
+func (s *Service) Apply(ctx context.Context, planPath string) (*Result, error) {
+	started := time.Now()
+	result := newResult(s.config.DryRun)
+	defer func() { result.Timings["total"] = time.Since(started).Milliseconds() }()
+
+	r, err := ReadPlan(planPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get current directory: %w", err)
+		return result, err
 	}
 
-	repoPath, err := findGitRepo(cwd)
+	if !s.config.DryRun {
+		state, err := s.state.Load()
+		if err != nil {
+			return result, err
+		}
+		if state != nil {
+			return result, fmt.Errorf("an unfinished run for branch %s exists; rerun branchtale to resume it or run with --rollback", state.Requirements.BranchName)
+		}
+	}
+	result.BaseBranch = r.BaseBranch
+	result.HeadBranch = r.BranchName
+
+	repoInfo, err := s.git.GetInfo()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to find git repository: %w", err)
+		return result, err
+	}
+	if r.CreateBranch && repoInfo.CurrentBranch != r.BaseBranch {
+		return result, fmt.Errorf("plan creates branch %s from %s, but the current branch is %s", r.BranchName, r.BaseBranch, repoInfo.CurrentBranch)
+	}
+	if !r.CreateBranch && repoInfo.CurrentBranch != r.BranchName {
+		return result, fmt.Errorf("plan is for branch %s, but the current branch is %s", r.BranchName, repoInfo.CurrentBranch)
 	}
 
-	gitRepo, err := git.NewRepository(repoPath, s.config.DryRun)
+	return result, s.Execute(ctx, r, result)
+}
+
+// ContentInput returns what content would be generated from on the current
+// branch, compared with origin/<main>, without generating anything.
+func (s *Service) ContentInput(ctx context.Context) (*ai.Input, error) {
+	repoInfo, err := s.git.GetInfo()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to initialize git repository: %w", err)
+		return nil, err
 	}
+	diffInfo, err := s.git.GetDiffBetweenBranches(ctx, "origin", repoInfo.MainBranch, repoInfo.CurrentBranch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff from origin/%s: %w", repoInfo.MainBranch, err)
+	}
+	branch := repoInfo.CurrentBranch
+	if repoInfo.IsOnMain {
+		branch = ""
+	}
+	return s.contentInput(ctx, diffInfo, branch), nil
+}
 
-	var generator ContentGenerator
-	if s.config.UseAI {
-		generator = ai.NewYandexGPT(s.config.YandexGPTAPIKey, s.config.YandexFolderID)
-	} else {
-		generator = ai.NewLocal()
+// generateContent generates the title, the description and, when input has
+// no branch yet, the branch name in one request. An answer that cannot be
+// parsed is replaced by a request per field.
+func (s *Service) generateContent(ctx context.Context, generator ContentGenerator, input *ai.Input) (*ai.Content, error) {
+	content, err := generator.GenerateContent(ctx, input)
+	if errors.Is(err, ai.ErrMalformedContent) {
+		fmt.Fprintf(s.out, "%s\n", color.YellowString("Could not parse the generated content, generating each part separately: %v", err))
+		return s.generateFields(ctx, generator, input, contentKinds(input)...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate pull request content: %w", err)
+	}
+	if err := s.finishFields(ctx, content, input, contentKinds(input)...); err != nil {
+		return nil, err
 	}
+	return content, nil
+}
 
-	return gitRepo, generator, nil
+// contentKinds are the fields generated for input: the branch name only when
+// there is no branch yet.
+func contentKinds(input *ai.Input) []ai.ContentKind {
+	kinds := []ai.ContentKind{ai.KindTitle, ai.KindDescription}
+	if input.Branch == "" {
+		kinds = append([]ai.ContentKind{ai.KindBranchName}, kinds...)
+	}
+	return kinds
 }
 
-func findGitRepo(startPath string) (string, error) {
-	currentPath := startPath
-	for {
-		gitPath := filepath.Join(currentPath, ".git")
-		if _, err := os.Stat(gitPath); err == nil {
-			return currentPath, nil
-		}
+// generateFields requests each of kinds separately and prepares them like
+// generateContent does.
+func (s *Service) generateFields(ctx context.Context, generator ContentGenerator, input *ai.Input, kinds ...ai.ContentKind) (*ai.Content, error) {
+	content, err := requestFields(ctx, generator, input, s.out, kinds...)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.finishFields(ctx, content, input, kinds...); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
 
-		parent := filepath.Dir(currentPath)
-		if parent == currentPath {
-			break
-		}
-		currentPath = parent
+// requestFields requests each of kinds concurrently; the first failure
+// cancels the other requests. Streamed text is shown on out in the order of
+// kinds.
+func requestFields(ctx context.Context, generator ContentGenerator, input *ai.Input, out io.Writer, kinds ...ai.ContentKind) (*ai.Content, error) {
+	content := &ai.Content{}
+	output := newOrderedOutput(out, len(kinds))
+	g, ctx := errgroup.WithContext(ctx)
+	for i, kind := range kinds {
+		section := output.section(i)
+		g.Go(func() error {
+			defer section.Close()
+			ctx := ai.WithStreamOutput(ctx, section)
+			var err error
+			switch kind {
+			case ai.KindBranchName:
+				if content.BranchName, err = generator.GenerateBranchName(ctx, input); err != nil {
+					return fmt.Errorf("failed to generate branch name: %w", err)
+				}
+			case ai.KindTitle:
+				if content.Title, err = generator.GeneratePRTitle(ctx, input); err != nil {
+					return fmt.Errorf("failed to generate PR title: %w", err)
+				}
+			case ai.KindDescription:
+				if content.Description, err = generator.GeneratePRDescription(ctx, input); err != nil {
+					return fmt.Errorf("failed to generate PR description: %w", err)
+				}
+			}
+			return nil
+		})
 	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
 
-	return "", fmt.Errorf("not a git repository (or any of the parent directories)")
+// finishFields turns the generated kinds of content into what is used: the
+// branch name is templated and made unique, the title formatted and the
+// description gets the ticket link.
+func (s *Service) finishFields(ctx context.Context, content *ai.Content, input *ai.Input, kinds ...ai.ContentKind) error {
+	var err error
+	for _, kind := range kinds {
+		switch kind {
+		case ai.KindBranchName:
+			content.BranchName, err = s.branchName(ctx, content.BranchName, input, nil)
+		case ai.KindTitle:
+			content.Title, err = s.formatTitle(content.Title, input)
+		case ai.KindDescription:
+			content.Description = s.withTicketLink(content.Description, input)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
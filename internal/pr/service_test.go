@@ -0,0 +1,395 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/git"
+)
+
+func newTestService(cfg *config.Config, gitRepo *fakeGit, generator *fakeGenerator, provider *fakeProvider) *Service {
+	s := NewService(cfg, gitRepo, generator, provider, &memoryStateStore{})
+	s.out = &bytes.Buffer{}
+	return s
+}
+
+func TestService_Run(t *testing.T) {
+	t.Setenv("BRANCHTALE_CONFIG_DIR", t.TempDir())
+	errBoom := errors.New("boom")
+	errMalformed := fmt.Errorf("%w: no JSON object", ai.ErrMalformedContent)
+
+	tests := []struct {
+		name         string
+		branch       string
+		cfg          config.Config
+		setup        func(g *fakeGit, gen *fakeGenerator, p *fakeProvider)
+		wantErr      string
+		wantStatus   string
+		wantBranch   string
+		wantPushed   []string
+		wantPRs      int
+		wantMerged   bool
+		wantCheckout string
+	}{
+		{
+			name:         "main branch creates feature branch and pull request",
+			branch:       "main",
+			cfg:          config.Config{GitHubToken: "token", BranchPrefix: "feature/"},
+			wantStatus:   StatusCompleted,
+			wantBranch:   "feature/add-response-cache",
+			wantPushed:   []string{"feature/add-response-cache"},
+			wantPRs:      1,
+			wantMerged:   true,
+			wantCheckout: "feature/add-response-cache",
+		},
+		{
+			name:       "main branch up to date does nothing",
+			branch:     "main",
+			cfg:        config.Config{GitHubToken: "token"},
+			setup:      func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.diff = &git.DiffInfo{} },
+			wantStatus: StatusUpToDate,
+		},
+		{
+			name:         "feature branch missing on remote is pushed",
+			branch:       "add-cache",
+			cfg:          config.Config{GitHubToken: "token"},
+			wantStatus:   StatusCompleted,
+			wantBranch:   "add-cache",
+			wantPushed:   []string{"add-cache"},
+			wantPRs:      1,
+			wantMerged:   true,
+			wantCheckout: "add-cache",
+		},
+		{
+			name:   "feature branch already on remote is not pushed",
+			branch: "add-cache",
+			cfg:    config.Config{GitHubToken: "token"},
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				g.remoteBranches["add-cache"] = true
+			},
+			wantStatus:   StatusCompleted,
+			wantBranch:   "add-cache",
+			wantPRs:      1,
+			wantMerged:   true,
+			wantCheckout: "add-cache",
+		},
+		{
+			name:         "dry run changes nothing and needs no token",
+			branch:       "main",
+			cfg:          config.Config{DryRun: true},
+			wantStatus:   StatusDryRun,
+			wantBranch:   "add-response-cache",
+			wantCheckout: "main",
+		},
+		{
+			name:    "repository info error",
+			branch:  "main",
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["GetInfo"] = errBoom },
+			wantErr: "boom",
+		},
+		{
+			name:    "diff error on main",
+			branch:  "main",
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["GetDiffBetweenBranches"] = errBoom },
+			wantErr: "failed to get local commits ahead of origin: boom",
+		},
+		{
+			name:    "diff error on feature branch",
+			branch:  "add-cache",
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["GetDiffBetweenBranches"] = errBoom },
+			wantErr: "failed to get diff from origin/main: boom",
+		},
+		{
+			name:    "remote branch check error",
+			branch:  "add-cache",
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["BranchExistsOnRemote"] = errBoom },
+			wantErr: "failed to check remote branch: boom",
+		},
+		{
+			name:    "content generation error",
+			branch:  "main",
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { gen.errs["GenerateContent"] = errBoom },
+			wantErr: "failed to generate pull request content: boom",
+		},
+		{
+			name:   "branch name generation error after malformed content",
+			branch: "main",
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				gen.errs["GenerateContent"] = errMalformed
+				gen.errs["GenerateBranchName"] = errBoom
+			},
+			wantErr: "failed to generate branch name: boom",
+		},
+		{
+			name:   "title generation error after malformed content",
+			branch: "main",
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				gen.errs["GenerateContent"] = errMalformed
+				gen.errs["GeneratePRTitle"] = errBoom
+			},
+			wantErr: "failed to generate PR title: boom",
+		},
+		{
+			name:   "description generation error after malformed content",
+			branch: "main",
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				gen.errs["GenerateContent"] = errMalformed
+				gen.errs["GeneratePRDescription"] = errBoom
+			},
+			wantErr: "failed to generate PR description: boom",
+		},
+		{
+			name:         "missing GitHub token fails before touching git",
+			branch:       "main",
+			cfg:          config.Config{},
+			wantErr:      "GITHUB_TOKEN environment variable is required",
+			wantCheckout: "main",
+		},
+		{
+			name:    "create branch error",
+			branch:  "main",
+			cfg:     config.Config{GitHubToken: "token"},
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["CreateBranch"] = errBoom },
+			wantErr: "boom",
+		},
+		{
+			name:    "checkout error",
+			branch:  "main",
+			cfg:     config.Config{GitHubToken: "token"},
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["CheckoutBranch"] = errBoom },
+			wantErr: "boom",
+		},
+		{
+			name:    "push error",
+			branch:  "main",
+			cfg:     config.Config{GitHubToken: "token"},
+			setup:   func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) { g.errs["PushBranch"] = errBoom },
+			wantErr: "boom",
+		},
+		{
+			name:   "remote url error",
+			branch: "add-cache",
+			cfg:    config.Config{GitHubToken: "token"},
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				g.remoteBranches["add-cache"] = true
+				g.errs["GetRemoteUrl"] = errBoom
+			},
+			wantErr: "boom",
+		},
+		{
+			name:   "remote is not GitHub",
+			branch: "add-cache",
+			cfg:    config.Config{GitHubToken: "token"},
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				g.remoteBranches["add-cache"] = true
+				g.remoteURL = "https://gitlab.com/owner/repo.git"
+			},
+			wantErr: "not a GitHub URL",
+		},
+		{
+			name:   "dry run remote is not GitHub",
+			branch: "add-cache",
+			cfg:    config.Config{DryRun: true},
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				g.remoteURL = "https://gitlab.com/owner/repo.git"
+			},
+			wantErr: "not a GitHub URL",
+		},
+		{
+			name:   "create pull request error",
+			branch: "add-cache",
+			cfg:    config.Config{GitHubToken: "token"},
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				g.remoteBranches["add-cache"] = true
+				p.errs["CreatePullRequest"] = errBoom
+			},
+			wantErr: "boom",
+		},
+		{
+			name:   "merge pull request error",
+			branch: "add-cache",
+			cfg:    config.Config{GitHubToken: "token"},
+			setup: func(g *fakeGit, gen *fakeGenerator, p *fakeProvider) {
+				g.remoteBranches["add-cache"] = true
+				p.errs["MergePullRequest"] = errBoom
+			},
+			wantErr:    "boom",
+			wantBranch: "add-cache",
+			wantPRs:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitRepo := newFakeGit(tt.branch)
+			generator := newFakeGenerator()
+			provider := newFakeProvider()
+			if tt.setup != nil {
+				tt.setup(gitRepo, generator, provider)
+			}
+			cfg := tt.cfg
+
+			result, err := newTestService(&cfg, gitRepo, generator, provider).Run(context.Background())
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result == nil {
+				t.Fatal("Expected a result even on error")
+			}
+
+			if tt.wantStatus != "" && result.Status != tt.wantStatus {
+				t.Errorf("Expected status %q, got %q", tt.wantStatus, result.Status)
+			}
+			if tt.wantBranch != "" && result.HeadBranch != tt.wantBranch {
+				t.Errorf("Expected head branch %q, got %q", tt.wantBranch, result.HeadBranch)
+			}
+			if strings.Join(gitRepo.pushed, ",") != strings.Join(tt.wantPushed, ",") {
+				t.Errorf("Expected pushed %v, got %v", tt.wantPushed, gitRepo.pushed)
+			}
+			if len(provider.pullRequests) != tt.wantPRs {
+				t.Fatalf("Expected %d pull requests, got %d", tt.wantPRs, len(provider.pullRequests))
+			}
+			if tt.wantPRs > 0 {
+				pr := provider.pullRequests[0]
+				if pr.HeadBranch != tt.wantBranch || pr.BaseBranch != "main" || pr.Owner != "owner" || pr.Repo != "repo" {
+					t.Errorf("Unexpected pull request: %+v", pr.CreatePullRequestRequest)
+				}
+				if pr.Merged != tt.wantMerged {
+					t.Errorf("Expected merged=%v, got %v", tt.wantMerged, pr.Merged)
+				}
+			}
+			if tt.wantCheckout != "" && gitRepo.current != tt.wantCheckout {
+				t.Errorf("Expected to end on %q, got %q", tt.wantCheckout, gitRepo.current)
+			}
+		})
+	}
+}
+
+func TestService_Run_result(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	cfg := &config.Config{GitHubToken: "token"}
+
+	result, err := newTestService(cfg, gitRepo, newFakeGenerator(), newFakeProvider()).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Repository != "owner/repo" {
+		t.Errorf("Expected repository owner/repo, got %q", result.Repository)
+	}
+	if !result.BranchCreated || !result.Pushed {
+		t.Errorf("Expected branch to be created and pushed: %+v", result)
+	}
+	if result.PullRequest == nil || result.PullRequest.Number != 1 || result.PullRequest.URL != "https://github.com/owner/repo/pull/1" {
+		t.Errorf("Unexpected pull request result: %+v", result.PullRequest)
+	}
+	if result.Merge == nil || !result.Merge.Merged || result.Merge.SHA != "abc123" {
+		t.Errorf("Unexpected merge result: %+v", result.Merge)
+	}
+	if result.Generated == nil || result.Generated.Title != "Add response cache" || result.Generated.BranchName != "add-response-cache" {
+		t.Errorf("Unexpected generated content: %+v", result.Generated)
+	}
+	if result.Plan == nil || !result.Plan.CreateBranch {
+		t.Errorf("Expected plan to be recorded: %+v", result.Plan)
+	}
+}
+
+func TestService_Run_generateContent(t *testing.T) {
+	t.Run("single request", func(t *testing.T) {
+		generator := newFakeGenerator()
+		generator.labels = []string{"enhancement"}
+
+		result, err := newTestService(&config.Config{DryRun: true}, newFakeGit("main"), generator, newFakeProvider()).Run(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if generator.calls != 1 {
+			t.Errorf("Expected one generation request, got %d", generator.calls)
+		}
+		if result.Generated.BranchName != "add-response-cache" || result.Generated.Title != "Add response cache" || strings.Join(result.Generated.Labels, ",") != "enhancement" {
+			t.Errorf("Unexpected generated content: %+v", result.Generated)
+		}
+	})
+
+	t.Run("falls back to separate requests", func(t *testing.T) {
+		generator := newFakeGenerator()
+		generator.errs["GenerateContent"] = fmt.Errorf("%w: no JSON object", ai.ErrMalformedContent)
+		s := newTestService(&config.Config{DryRun: true}, newFakeGit("main"), generator, newFakeProvider())
+
+		result, err := s.Run(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if generator.calls != 4 {
+			t.Errorf("Expected the combined request and three separate ones, got %d", generator.calls)
+		}
+		if result.Generated.BranchName != "add-response-cache" || result.Generated.Description != "Adds a cache for responses." {
+			t.Errorf("Unexpected generated content: %+v", result.Generated)
+		}
+		if !strings.Contains(s.out.(*bytes.Buffer).String(), "generating each part separately") {
+			t.Error("Expected the fallback to be reported")
+		}
+	})
+}
+
+func TestService_Apply(t *testing.T) {
+	path := t.TempDir() + "/plan.json"
+	plan := &Requirements{
+		CreateBranch:      true,
+		PushBranch:        true,
+		BranchName:        "feature/add-cache",
+		BaseBranch:        "main",
+		CreatePullRequest: true,
+		PullRequestTitle:  "Add cache",
+	}
+	if err := WritePlan(path, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("executes plan", func(t *testing.T) {
+		gitRepo := newFakeGit("main")
+		generator := newFakeGenerator()
+		provider := newFakeProvider()
+		s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, generator, provider)
+
+		result, err := s.Apply(context.Background(), path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if generator.calls != 0 {
+			t.Errorf("Expected no generation, got %d calls", generator.calls)
+		}
+		if result.Status != StatusCompleted || len(provider.pullRequests) != 1 || provider.pullRequests[0].Title != "Add cache" {
+			t.Errorf("Unexpected apply result: %+v", result)
+		}
+		if provider.pullRequests[0].Merged {
+			t.Error("Expected plan without merge not to merge")
+		}
+	})
+
+	t.Run("rejects title that is not conventional", func(t *testing.T) {
+		provider := newFakeProvider()
+		s := newTestService(&config.Config{GitHubToken: "token", TitleStyle: config.TitleStyleConventional}, newFakeGit("main"), newFakeGenerator(), provider)
+		if _, err := s.Apply(context.Background(), path); err == nil || len(provider.pullRequests) != 0 {
+			t.Errorf("Expected the plain title to be rejected before creating the PR, got %v", err)
+		}
+	})
+
+	t.Run("rejects plan for another branch", func(t *testing.T) {
+		s := newTestService(&config.Config{GitHubToken: "token"}, newFakeGit("other"), newFakeGenerator(), newFakeProvider())
+		if _, err := s.Apply(context.Background(), path); err == nil {
+			t.Error("Expected error when not on the plan's base branch")
+		}
+	})
+}
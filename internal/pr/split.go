@@ -0,0 +1,304 @@
+package pr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/git"
+	"github.com/deck/branchtale/internal/vcs"
+	"github.com/fatih/color"
+)
+
+type SplitGroupResult struct {
+	Branch      string             `json:"branch"`
+	Commits     []string           `json:"commits"`
+	Files       []string           `json:"files"`
+	PullRequest *PullRequestResult `json:"pull_request,omitempty"`
+}
+
+type splitCommit struct {
+	hash    string
+	message string
+	subject string
+	files   []string
+	patch   string
+}
+
+type commitGroup struct {
+	commits []*splitCommit
+	input   *ai.Input
+	branch  string
+}
+
+func (g *commitGroup) files() []string {
+	var files []string
+	for _, c := range g.commits {
+		files = append(files, c.files...)
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+func (g *commitGroup) patch() string {
+	var patches []string
+	for _, c := range g.commits {
+		patches = append(patches, c.patch)
+	}
+	return strings.Join(patches, "\n")
+}
+
+func (g *commitGroup) hashes() []string {
+	var hashes []string
+	for _, c := range g.commits {
+		hashes = append(hashes, c.hash)
+	}
+	return hashes
+}
+
+// groupCommits puts commits that touch the same directory into the same
+// group, so that every group can be cherry-picked onto the base on its own.
+// Commits are expected oldest first and keep that order within a group.
+func groupCommits(commits []*splitCommit) []*commitGroup {
+	var groups []*commitGroup
+	var areas []map[string]bool
+	for _, commit := range commits {
+		commitAreas := map[string]bool{}
+		for _, file := range commit.files {
+			commitAreas[path.Dir(file)] = true
+		}
+
+		target := -1
+		for i := 0; i < len(groups); i++ {
+			overlaps := false
+			for area := range commitAreas {
+				if areas[i][area] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				continue
+			}
+			if target < 0 {
+				target = i
+				continue
+			}
+			// The commit joins two groups: fold the later one into the first.
+			groups[target].commits = append(groups[target].commits, groups[i].commits...)
+			for area := range areas[i] {
+				areas[target][area] = true
+			}
+			groups = slices.Delete(groups, i, i+1)
+			areas = slices.Delete(areas, i, i+1)
+			i--
+		}
+
+		if target < 0 {
+			groups = append(groups, &commitGroup{})
+			areas = append(areas, map[string]bool{})
+			target = len(groups) - 1
+		}
+		groups[target].commits = append(groups[target].commits, commit)
+		for area := range commitAreas {
+			areas[target][area] = true
+		}
+	}
+
+	order := map[*splitCommit]int{}
+	for i, commit := range commits {
+		order[commit] = i
+	}
+	for _, g := range groups {
+		slices.SortFunc(g.commits, func(a, b *splitCommit) int { return order[a] - order[b] })
+	}
+	return groups
+}
+
+// Split turns unrelated local commits on the main branch into separate
+// branches and pull requests. Commits are grouped by the directories they
+// touch; each group is cherry-picked onto origin/<main> without touching the
+// current checkout. If any group does not apply cleanly, every branch created
+// so far is deleted and nothing is pushed.
+func (s *Service) Split(ctx context.Context, confirmed bool) (*Result, error) {
+	started := time.Now()
+	result := newResult(s.config.DryRun)
+	defer func() { result.Timings["total"] = time.Since(started).Milliseconds() }()
+	ctx = ai.WithStreamOutput(ctx, s.out)
+
+	repoInfo, err := s.git.GetInfo()
+	if err != nil {
+		return result, err
+	}
+	if !repoInfo.IsOnMain {
+		return result, fmt.Errorf("split works on local commits on %s, but the current branch is %s", repoInfo.MainBranch, repoInfo.CurrentBranch)
+	}
+	result.BaseBranch = repoInfo.MainBranch
+
+	if !s.config.DryRun {
+		state, err := s.state.Load()
+		if err != nil {
+			return result, err
+		}
+		if state != nil {
+			return result, fmt.Errorf("an unfinished run for branch %s exists; rerun branchtale to resume it or run with --rollback", state.Requirements.BranchName)
+		}
+	}
+
+	diffInfo, err := s.git.GetDiffBetweenBranches(ctx, "origin", repoInfo.MainBranch, repoInfo.MainBranch)
+	if err != nil {
+		return result, fmt.Errorf("failed to get local commits ahead of origin: %w", err)
+	}
+	if len(diffInfo.Commits) == 0 {
+		fmt.Fprintln(s.out, color.BlueString("Your branch is up to date with origin/%s. Nothing to do.", repoInfo.MainBranch))
+		result.Status = StatusUpToDate
+		return result, nil
+	}
+
+	var commits []*splitCommit
+	for _, commit := range slices.Backward(diffInfo.Commits) {
+		if commit.NumParents() > 1 {
+			return result, fmt.Errorf("cannot split merge commit %s", commit.Hash.String()[:8])
+		}
+		changes, err := s.git.GetCommitChanges(ctx, commit.Hash.String())
+		if err != nil {
+			return result, err
+		}
+		subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+		commits = append(commits, &splitCommit{hash: commit.Hash.String(), message: commit.Message, subject: subject, files: changes.Files, patch: changes.Patch})
+	}
+
+	groups := groupCommits(commits)
+	if len(groups) < 2 {
+		return result, fmt.Errorf("all %d commits touch the same directories; run branchtale to open a single pull request instead", len(commits))
+	}
+
+	generationStarted := time.Now()
+	if err := s.nameGroups(ctx, groups); err != nil {
+		return result, err
+	}
+	result.Timings["generate_branch_name"] = time.Since(generationStarted).Milliseconds()
+
+	fmt.Fprintf(s.out, "Proposed split of %d commits into %d pull requests:\n", len(commits), len(groups))
+	for _, g := range groups {
+		fmt.Fprintf(s.out, "\n%s\n", color.GreenString(g.branch))
+		for _, c := range g.commits {
+			fmt.Fprintf(s.out, "  %s %s\n", color.YellowString(c.hash[:8]), c.subject)
+		}
+		fmt.Fprintf(s.out, "  files: %s\n", strings.Join(g.files(), ", "))
+		result.Split = append(result.Split, &SplitGroupResult{Branch: g.branch, Commits: g.hashes(), Files: g.files()})
+	}
+	fmt.Fprintln(s.out)
+
+	if s.config.DryRun {
+		result.Status = StatusDryRun
+		return result, nil
+	}
+
+	if s.prompter != nil {
+		if !s.prompter.YesNo(fmt.Sprintf("Create %d branches and pull requests?", len(groups))) {
+			fmt.Fprintln(s.out, color.YellowString("Aborted. Nothing was created."))
+			result.Status = StatusAborted
+			return result, nil
+		}
+	} else if !confirmed {
+		return result, fmt.Errorf("confirm the proposed split with --yes when not running interactively")
+	}
+
+	if err := s.config.RequireGitHubToken(); err != nil {
+		return result, err
+	}
+	owner, repo, err := remoteRepository(ctx, s.git)
+	if err != nil {
+		return result, err
+	}
+	result.Repository = owner + "/" + repo
+
+	if err := s.cherryPickGroups(ctx, groups, "origin/"+repoInfo.MainBranch); err != nil {
+		return result, err
+	}
+
+	for i, g := range groups {
+		if err := s.git.PushBranch(ctx, g.branch, "origin"); err != nil {
+			return result, err
+		}
+		fmt.Fprintf(s.out, "Pushed branch: %s\n", color.GreenString(g.branch))
+
+		content, err := s.generateContent(ctx, s.generator, g.input)
+		if err != nil {
+			return result, err
+		}
+		title, description := content.Title, content.Description
+		response, err := s.vcs.CreatePullRequest(ctx, &vcs.CreatePullRequestRequest{
+			Owner:       owner,
+			Repo:        repo,
+			Title:       title,
+			Description: description,
+			HeadBranch:  g.branch,
+			BaseBranch:  repoInfo.MainBranch,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Split[i].PullRequest = &PullRequestResult{Number: response.Number, URL: response.URL}
+		fmt.Fprintf(s.out, "Pull Request created: %s\n", color.GreenString(response.URL))
+	}
+
+	fmt.Fprintf(s.out, "Local %s still contains the split commits. Once you no longer need them there, run: git reset --keep origin/%s\n", repoInfo.MainBranch, repoInfo.MainBranch)
+	result.Status = StatusCompleted
+	return result, nil
+}
+
+func (s *Service) nameGroups(ctx context.Context, groups []*commitGroup) error {
+	reserved := map[string]bool{}
+	for _, g := range groups {
+		var messages []string
+		for _, c := range g.commits {
+			messages = append(messages, c.message)
+		}
+		g.input = s.newInput(ctx, g.patch(), g.files(), messages, "")
+
+		slug, err := s.generator.GenerateBranchName(ctx, g.input)
+		if err != nil {
+			return fmt.Errorf("failed to generate branch name: %w", err)
+		}
+		branchName, err := s.branchName(ctx, slug, g.input, reserved)
+		if err != nil {
+			return err
+		}
+		reserved[branchName] = true
+		g.branch = branchName
+		g.input.Branch = branchName
+	}
+	return nil
+}
+
+func (s *Service) cherryPickGroups(ctx context.Context, groups []*commitGroup, base string) error {
+	for i, g := range groups {
+		err := s.git.CherryPickBranch(ctx, g.branch, base, g.hashes())
+		if err == nil {
+			fmt.Fprintf(s.out, "Created branch: %s\n", color.GreenString(g.branch))
+			continue
+		}
+
+		for _, created := range groups[:i] {
+			if err := s.git.DeleteBranch(ctx, created.branch); err != nil {
+				fmt.Fprintf(s.out, "%s\n", color.RedString("Failed to delete branch %s: %v", created.branch, err))
+			}
+		}
+
+		var conflict *git.CherryPickConflictError
+		if errors.As(err, &conflict) {
+			fmt.Fprintln(s.out, color.RedString("Split aborted: commit %s does not apply to %s without the commits of the other groups.", conflict.Commit[:8], base))
+			fmt.Fprintf(s.out, "Conflicting files: %s\n", strings.Join(conflict.Files, ", "))
+			fmt.Fprintln(s.out, "No branches were kept and nothing was pushed. Keep these commits together with the ones they depend on and open a single pull request instead.")
+		}
+		return err
+	}
+	return nil
+}
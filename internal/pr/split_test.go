@@ -0,0 +1,111 @@
+package pr
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/git"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestGroupCommits(t *testing.T) {
+	a := &splitCommit{hash: "a", files: []string{"cache/cache.go"}}
+	b := &splitCommit{hash: "b", files: []string{"docs/README.md"}}
+	c := &splitCommit{hash: "c", files: []string{"cache/cache_test.go"}}
+	d := &splitCommit{hash: "d", files: []string{"api/handler.go"}}
+	e := &splitCommit{hash: "e", files: []string{"api/routes.go", "docs/api.md"}}
+
+	groups := groupCommits([]*splitCommit{a, b, c, d, e})
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	if got := strings.Join(groups[0].hashes(), ","); got != "a,c" {
+		t.Errorf("Expected first group a,c, got %s", got)
+	}
+	if got := strings.Join(groups[1].hashes(), ","); got != "b,d,e" {
+		t.Errorf("Expected docs and api merged in commit order, got %s", got)
+	}
+}
+
+// newSplitGit returns a repository on main with two unrelated local commits.
+func newSplitGit() *fakeGit {
+	gitRepo := newFakeGit("main")
+	gitRepo.diff.Commits = []*object.Commit{
+		fakeCommit("2222222222222222222222222222222222222222", "Document setup"),
+		fakeCommit("1111111111111111111111111111111111111111", "Add cache"),
+	}
+	gitRepo.changes["1111111111111111111111111111111111111111"] = &git.CommitChanges{Files: []string{"cache/cache.go"}, Patch: "cache patch"}
+	gitRepo.changes["2222222222222222222222222222222222222222"] = &git.CommitChanges{Files: []string{"README.md"}, Patch: "readme patch"}
+	return gitRepo
+}
+
+func TestService_Split(t *testing.T) {
+	gitRepo := newSplitGit()
+	generator := newFakeGenerator()
+	generator.branchName = ""
+	provider := newFakeProvider()
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, generator, provider)
+
+	result, err := s.Split(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusCompleted || len(result.Split) != 2 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if got := gitRepo.cherryPicked["add-cache"]; len(got) != 1 || got[0] != "1111111111111111111111111111111111111111" {
+		t.Errorf("Expected the oldest commit on add-cache, got %v", got)
+	}
+	if strings.Join(gitRepo.pushed, ",") != "add-cache,document-setup" {
+		t.Errorf("Unexpected pushes: %v", gitRepo.pushed)
+	}
+	if len(provider.pullRequests) != 2 || provider.pullRequests[1].BaseBranch != "main" {
+		t.Errorf("Expected a pull request per group against main, got %+v", provider.pullRequests)
+	}
+	if gitRepo.current != "main" {
+		t.Errorf("Expected to stay on main, got %s", gitRepo.current)
+	}
+}
+
+func TestService_Split_conflictRemovesBranches(t *testing.T) {
+	gitRepo := newSplitGit()
+	generator := newFakeGenerator()
+	generator.branchName = ""
+	gitRepo.errs["CherryPickBranch document-setup"] = &git.CherryPickConflictError{
+		Branch: "document-setup",
+		Commit: "2222222222222222222222222222222222222222",
+		Files:  []string{"README.md"},
+	}
+	provider := newFakeProvider()
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, generator, provider)
+
+	if _, err := s.Split(context.Background(), true); err == nil {
+		t.Fatal("Expected the conflict to be reported")
+	}
+	if gitRepo.localBranches["add-cache"] {
+		t.Error("Expected branches of earlier groups to be deleted")
+	}
+	if len(gitRepo.pushed) != 0 || len(provider.pullRequests) != 0 {
+		t.Error("Expected nothing to be pushed")
+	}
+}
+
+func TestService_Split_requiresConfirmation(t *testing.T) {
+	s := newTestService(&config.Config{GitHubToken: "token"}, newSplitGit(), newFakeGenerator(), newFakeProvider())
+
+	if _, err := s.Split(context.Background(), false); err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Errorf("Expected error asking for --yes, got %v", err)
+	}
+}
+
+func TestService_Split_singleGroup(t *testing.T) {
+	gitRepo := newSplitGit()
+	gitRepo.changes["2222222222222222222222222222222222222222"].Files = []string{"cache/cache_test.go"}
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), newFakeProvider())
+
+	if _, err := s.Split(context.Background(), true); err == nil {
+		t.Error("Expected an error when there is nothing to split")
+	}
+}
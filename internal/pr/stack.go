@@ -0,0 +1,389 @@
+package pr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/git"
+	"github.com/deck/branchtale/internal/vcs"
+	"github.com/fatih/color"
+)
+
+const (
+	stackStartMarker = "<!-- branchtale-stack -->"
+	stackEndMarker   = "<!-- /branchtale-stack -->"
+)
+
+type StackBranchResult struct {
+	Branch      string             `json:"branch"`
+	BaseBranch  string             `json:"base_branch"`
+	PullRequest *PullRequestResult `json:"pull_request,omitempty"`
+	Created     bool               `json:"created"`
+	Retargeted  bool               `json:"retargeted"`
+	Rebased     bool               `json:"rebased"`
+	Pushed      bool               `json:"pushed"`
+}
+
+type stackEntry struct {
+	branch string
+	base   string
+	pr     *vcs.PullRequest
+	result *StackBranchResult
+}
+
+func remoteRepository(ctx context.Context, gitRepo GitRepository) (string, string, error) {
+	remoteUrl, err := gitRepo.GetRemoteUrl(ctx, "origin")
+	if err != nil {
+		return "", "", err
+	}
+	return vcs.ParseGitHubURL(remoteUrl)
+}
+
+// ancestorBranches returns the local branches whose tips are behind branch
+// and not yet part of origin/<main>, nearest first.
+func (s *Service) ancestorBranches(ctx context.Context, branch, mainBranch string) ([]string, error) {
+	branches, err := s.git.ListBranches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	branches = slices.DeleteFunc(branches, func(b string) bool { return b == branch || b == mainBranch })
+	if len(branches) == 0 {
+		return nil, nil
+	}
+
+	head, err := s.git.ResolveRevision(ctx, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	var ancestors []string
+	for _, candidate := range branches {
+		tip, err := s.git.ResolveRevision(ctx, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if tip == head {
+			continue
+		}
+		isAncestor, err := s.git.IsAncestor(ctx, candidate, branch)
+		if err != nil {
+			return nil, err
+		}
+		if !isAncestor {
+			continue
+		}
+		inMain, err := s.git.IsAncestor(ctx, candidate, "origin/"+mainBranch)
+		if err != nil {
+			return nil, err
+		}
+		if inMain {
+			continue
+		}
+
+		// Keep the list ordered so that every branch comes before its ancestors.
+		i := 0
+		for ; i < len(ancestors); i++ {
+			nearer, err := s.git.IsAncestor(ctx, ancestors[i], candidate)
+			if err != nil {
+				return nil, err
+			}
+			if nearer {
+				break
+			}
+		}
+		ancestors = slices.Insert(ancestors, i, candidate)
+	}
+	return ancestors, nil
+}
+
+func (s *Service) findPullRequest(ctx context.Context, owner, repo, branch string) (*vcs.PullRequest, error) {
+	return s.vcs.FindPullRequest(ctx, &vcs.FindPullRequestRequest{Owner: owner, Repo: repo, HeadBranch: branch})
+}
+
+// stackParent finds the nearest local ancestor of branch that has an open
+// pull request, which is what a pull request for branch should target.
+func (s *Service) stackParent(ctx context.Context, branch, mainBranch string) (*vcs.PullRequest, error) {
+	ancestors, err := s.ancestorBranches(ctx, branch, mainBranch)
+	if err != nil || len(ancestors) == 0 {
+		return nil, err
+	}
+
+	owner, repo, err := remoteRepository(ctx, s.git)
+	if err != nil {
+		return nil, err
+	}
+	for _, ancestor := range ancestors {
+		pr, err := s.findPullRequest(ctx, owner, repo, ancestor)
+		if err != nil {
+			return nil, err
+		}
+		if pr != nil && pr.Open {
+			return pr, nil
+		}
+	}
+	return nil, nil
+}
+
+// Stack creates or updates a pull request for every branch in the stack that
+// ends at the current branch, each targeting the branch below it, and links
+// them to each other. Branches stacked on a pull request that has been merged
+// are rebased onto the main branch and retargeted first.
+func (s *Service) Stack(ctx context.Context) (*Result, error) {
+	started := time.Now()
+	result := newResult(s.config.DryRun)
+	defer func() { result.Timings["total"] = time.Since(started).Milliseconds() }()
+	ctx = ai.WithStreamOutput(ctx, s.out)
+
+	repoInfo, err := s.git.GetInfo()
+	if err != nil {
+		return result, err
+	}
+	if repoInfo.IsOnMain {
+		return result, fmt.Errorf("check out the top branch of a stack to run stack")
+	}
+	result.BaseBranch = repoInfo.MainBranch
+	result.HeadBranch = repoInfo.CurrentBranch
+
+	if !s.config.DryRun {
+		state, err := s.state.Load()
+		if err != nil {
+			return result, err
+		}
+		if state != nil {
+			return result, fmt.Errorf("an unfinished run for branch %s exists; rerun branchtale to resume it or run with --rollback", state.Requirements.BranchName)
+		}
+		if err := s.config.RequireGitHubToken(); err != nil {
+			return result, err
+		}
+	}
+
+	owner, repo, err := remoteRepository(ctx, s.git)
+	if err != nil {
+		return result, err
+	}
+	result.Repository = owner + "/" + repo
+
+	if err := s.git.Fetch(ctx, "origin"); err != nil {
+		return result, err
+	}
+
+	entries, mergedParent, err := s.stackEntries(ctx, owner, repo, repoInfo.CurrentBranch, repoInfo.MainBranch)
+	if err != nil {
+		return result, err
+	}
+	for _, e := range entries {
+		result.Stack = append(result.Stack, e.result)
+	}
+
+	fmt.Fprintln(s.out, "Stack:")
+	for _, e := range entries {
+		fmt.Fprintf(s.out, "  %s <- %s\n", e.base, color.GreenString(e.branch))
+	}
+
+	if mergedParent != "" {
+		if err := s.rebaseStack(ctx, entries, mergedParent, repoInfo); err != nil {
+			return result, err
+		}
+	}
+
+	if s.config.DryRun {
+		for _, e := range entries {
+			switch {
+			case e.pr == nil:
+				fmt.Fprintf(s.out, "- Create pull request for %s into %s\n", color.GreenString(e.branch), color.GreenString(e.base))
+			case e.pr.BaseBranch != e.base:
+				fmt.Fprintf(s.out, "- Retarget #%d to %s\n", e.pr.Number, color.GreenString(e.base))
+			}
+		}
+		fmt.Fprintln(s.out, "- Update stack links in every pull request")
+		result.Status = StatusDryRun
+		return result, nil
+	}
+
+	for _, e := range entries {
+		if err := s.syncStackEntry(ctx, owner, repo, e); err != nil {
+			return result, err
+		}
+	}
+
+	for i, e := range entries {
+		description := withStackSection(e.pr.Description, stackSection(entries, i))
+		if description == e.pr.Description {
+			continue
+		}
+		err := s.vcs.UpdatePullRequest(ctx, &vcs.UpdatePullRequestRequest{Owner: owner, Repo: repo, Number: e.pr.Number, Description: description})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	fmt.Fprintln(s.out, color.GreenString("Stack is up to date."))
+	result.Status = StatusCompleted
+	return result, nil
+}
+
+// stackEntries walks down from branch through its nearest local ancestors
+// until it reaches main or a branch whose pull request was merged, which it
+// returns separately.
+func (s *Service) stackEntries(ctx context.Context, owner, repo, branch, mainBranch string) ([]*stackEntry, string, error) {
+	var entries []*stackEntry
+	var mergedParent string
+	pr, err := s.findPullRequest(ctx, owner, repo, branch)
+	if err != nil {
+		return nil, "", err
+	}
+	for current := branch; ; {
+		if pr != nil && !pr.Open {
+			pr = nil
+		}
+		entries = append([]*stackEntry{{branch: current, pr: pr}}, entries...)
+
+		ancestors, err := s.ancestorBranches(ctx, current, mainBranch)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(ancestors) == 0 {
+			break
+		}
+		parentPR, err := s.findPullRequest(ctx, owner, repo, ancestors[0])
+		if err != nil {
+			return nil, "", err
+		}
+		if parentPR != nil && parentPR.Merged {
+			mergedParent = ancestors[0]
+			break
+		}
+		current, pr = ancestors[0], parentPR
+	}
+
+	for i, e := range entries {
+		e.base = mainBranch
+		if i > 0 {
+			e.base = entries[i-1].branch
+		}
+		e.result = &StackBranchResult{Branch: e.branch, BaseBranch: e.base}
+		if e.pr != nil {
+			e.result.PullRequest = &PullRequestResult{Number: e.pr.Number, URL: e.pr.URL}
+		}
+	}
+	return entries, mergedParent, nil
+}
+
+// rebaseStack moves the stack off a parent that has been merged: the lowest
+// branch is replayed onto origin/<main>, every branch above it onto the
+// rebased branch below.
+func (s *Service) rebaseStack(ctx context.Context, entries []*stackEntry, mergedParent string, repoInfo *git.RepoInfo) error {
+	fmt.Fprintf(s.out, "%s was merged; rebasing the stack onto origin/%s\n", color.YellowString(mergedParent), repoInfo.MainBranch)
+
+	upstream := mergedParent
+	onto := "origin/" + repoInfo.MainBranch
+	for _, e := range entries {
+		oldTip, err := s.git.ResolveRevision(ctx, e.branch)
+		if err != nil {
+			return err
+		}
+		if s.config.DryRun {
+			fmt.Fprintf(s.out, "- Rebase %s onto %s\n", color.GreenString(e.branch), color.GreenString(onto))
+		} else {
+			if err := s.git.Rebase(ctx, onto, upstream, e.branch); err != nil {
+				return err
+			}
+			e.result.Rebased = true
+			fmt.Fprintf(s.out, "Rebased %s onto %s\n", color.GreenString(e.branch), color.GreenString(onto))
+		}
+		upstream, onto = oldTip, e.branch
+	}
+
+	if s.config.DryRun {
+		return nil
+	}
+	return s.git.CheckoutBranch(ctx, repoInfo.CurrentBranch)
+}
+
+func (s *Service) syncStackEntry(ctx context.Context, owner, repo string, e *stackEntry) error {
+	onRemote, err := s.git.BranchExistsOnRemote(ctx, e.branch, "origin")
+	if err != nil {
+		return fmt.Errorf("failed to check remote branch: %w", err)
+	}
+	if !onRemote || e.result.Rebased {
+		if err := s.git.PushBranch(ctx, e.branch, "origin"); err != nil {
+			return err
+		}
+		e.result.Pushed = true
+		fmt.Fprintf(s.out, "Pushed branch: %s\n", color.GreenString(e.branch))
+	}
+
+	if e.pr == nil {
+		diffInfo, err := s.git.GetDiffBetweenBranches(ctx, "origin", e.base, e.branch)
+		if err != nil {
+			return fmt.Errorf("failed to get diff from origin/%s: %w", e.base, err)
+		}
+		content, err := s.generateContent(ctx, s.generator, s.contentInput(ctx, diffInfo, e.branch))
+		if err != nil {
+			return err
+		}
+		title, description := content.Title, content.Description
+
+		response, err := s.vcs.CreatePullRequest(ctx, &vcs.CreatePullRequestRequest{
+			Owner:       owner,
+			Repo:        repo,
+			Title:       title,
+			Description: description,
+			HeadBranch:  e.branch,
+			BaseBranch:  e.base,
+		})
+		if err != nil {
+			return err
+		}
+		e.pr = &vcs.PullRequest{Number: response.Number, URL: response.URL, Title: title, Description: description, HeadBranch: e.branch, BaseBranch: e.base, Open: true}
+		e.result.Created = true
+		e.result.PullRequest = &PullRequestResult{Number: response.Number, URL: response.URL}
+		fmt.Fprintf(s.out, "Pull Request created: %s\n", color.GreenString(response.URL))
+		return nil
+	}
+
+	if e.pr.BaseBranch != e.base {
+		err := s.vcs.UpdatePullRequest(ctx, &vcs.UpdatePullRequestRequest{Owner: owner, Repo: repo, Number: e.pr.Number, BaseBranch: e.base})
+		if err != nil {
+			return err
+		}
+		e.pr.BaseBranch = e.base
+		e.result.Retargeted = true
+		fmt.Fprintf(s.out, "Retargeted #%d to %s\n", e.pr.Number, color.GreenString(e.base))
+	}
+	return nil
+}
+
+func stackSection(entries []*stackEntry, current int) string {
+	var b strings.Builder
+	b.WriteString(stackStartMarker + "\n")
+	b.WriteString("**Stack**\n\n")
+	fmt.Fprintf(&b, "- `%s`\n", entries[0].base)
+	for i, e := range entries {
+		if i == current {
+			fmt.Fprintf(&b, "- **#%d** `%s` (this pull request)\n", e.pr.Number, e.branch)
+		} else {
+			fmt.Fprintf(&b, "- #%d `%s`\n", e.pr.Number, e.branch)
+		}
+	}
+	b.WriteString(stackEndMarker)
+	return b.String()
+}
+
+// withStackSection replaces the stack section of a description, or appends
+// one if there is none yet.
+func withStackSection(description, section string) string {
+	start := strings.Index(description, stackStartMarker)
+	end := strings.Index(description, stackEndMarker)
+	if start >= 0 && end > start {
+		return description[:start] + section + description[end+len(stackEndMarker):]
+	}
+	if strings.TrimSpace(description) == "" {
+		return section
+	}
+	return strings.TrimRight(description, "\n") + "\n\n" + section
+}
@@ -0,0 +1,151 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/vcs"
+)
+
+// newStackGit returns a repository with main <- feature-a <- feature-b checked out at feature-b.
+func newStackGit() *fakeGit {
+	gitRepo := newFakeGit("feature-b")
+	gitRepo.localBranches["feature-a"] = true
+	gitRepo.revisions["feature-a"] = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	gitRepo.revisions["feature-b"] = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	gitRepo.ancestors["feature-a"] = []string{"main"}
+	gitRepo.ancestors["feature-b"] = []string{"main", "feature-a"}
+	gitRepo.ancestors["origin/main"] = []string{"main"}
+	return gitRepo
+}
+
+func TestService_Run_stackedBranch(t *testing.T) {
+	gitRepo := newStackGit()
+	gitRepo.remoteBranches["feature-b"] = true
+	provider := newFakeProvider()
+	provider.pullRequests = []*fakePullRequest{{CreatePullRequestRequest: vcs.CreatePullRequestRequest{HeadBranch: "feature-a", BaseBranch: "main"}, Number: 1}}
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), provider)
+
+	result, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(provider.pullRequests) != 2 || provider.pullRequests[1].BaseBranch != "feature-a" {
+		t.Fatalf("Expected pull request targeting feature-a, got %+v", provider.pullRequests)
+	}
+	if provider.pullRequests[1].Merged || result.Merge != nil {
+		t.Error("Expected stacked pull request not to be merged")
+	}
+	if result.BaseBranch != "feature-a" {
+		t.Errorf("Expected base feature-a in result, got %s", result.BaseBranch)
+	}
+}
+
+func TestService_Run_ignoresAncestorWithoutOpenPullRequest(t *testing.T) {
+	gitRepo := newStackGit()
+	gitRepo.remoteBranches["feature-b"] = true
+	provider := newFakeProvider()
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), provider)
+
+	if _, err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if provider.pullRequests[0].BaseBranch != "main" {
+		t.Errorf("Expected pull request targeting main, got %s", provider.pullRequests[0].BaseBranch)
+	}
+}
+
+func TestService_Stack_createsAndLinks(t *testing.T) {
+	gitRepo := newStackGit()
+	provider := newFakeProvider()
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), provider)
+
+	result, err := s.Stack(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusCompleted || len(result.Stack) != 2 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if len(provider.pullRequests) != 2 {
+		t.Fatalf("Expected two pull requests, got %d", len(provider.pullRequests))
+	}
+	if provider.pullRequests[0].HeadBranch != "feature-a" || provider.pullRequests[0].BaseBranch != "main" {
+		t.Errorf("Unexpected lower pull request: %+v", provider.pullRequests[0])
+	}
+	if provider.pullRequests[1].HeadBranch != "feature-b" || provider.pullRequests[1].BaseBranch != "feature-a" {
+		t.Errorf("Unexpected upper pull request: %+v", provider.pullRequests[1])
+	}
+	for _, pr := range provider.pullRequests {
+		if !strings.Contains(pr.Description, stackStartMarker) || !strings.Contains(pr.Description, "#1") || !strings.Contains(pr.Description, "#2") {
+			t.Errorf("Expected stack links in description, got %q", pr.Description)
+		}
+	}
+	if strings.Join(gitRepo.pushed, ",") != "feature-a,feature-b" {
+		t.Errorf("Expected both branches pushed bottom up, got %v", gitRepo.pushed)
+	}
+}
+
+func TestService_Stack_rebasesAfterMerge(t *testing.T) {
+	gitRepo := newStackGit()
+	gitRepo.remoteBranches["feature-b"] = true
+	provider := newFakeProvider()
+	provider.pullRequests = []*fakePullRequest{
+		{CreatePullRequestRequest: vcs.CreatePullRequestRequest{HeadBranch: "feature-a", BaseBranch: "main"}, Number: 1, Merged: true},
+		{CreatePullRequestRequest: vcs.CreatePullRequestRequest{HeadBranch: "feature-b", BaseBranch: "feature-a", Description: "Adds B."}, Number: 2},
+	}
+	s := newTestService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), provider)
+
+	result, err := s.Stack(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(gitRepo.rebased, ",") != "feature-a..feature-b->origin/main" {
+		t.Errorf("Unexpected rebases: %v", gitRepo.rebased)
+	}
+	if provider.pullRequests[1].BaseBranch != "main" {
+		t.Errorf("Expected #2 retargeted to main, got %s", provider.pullRequests[1].BaseBranch)
+	}
+	if len(result.Stack) != 1 || !result.Stack[0].Rebased || !result.Stack[0].Retargeted || !result.Stack[0].Pushed {
+		t.Errorf("Unexpected stack result: %+v", result.Stack)
+	}
+	if !strings.HasPrefix(provider.pullRequests[1].Description, "Adds B.") {
+		t.Errorf("Expected original description kept, got %q", provider.pullRequests[1].Description)
+	}
+}
+
+func TestService_Stack_dryRun(t *testing.T) {
+	gitRepo := newStackGit()
+	provider := newFakeProvider()
+	s := newTestService(&config.Config{DryRun: true}, gitRepo, newFakeGenerator(), provider)
+	out := &bytes.Buffer{}
+	s.out = out
+
+	result, err := s.Stack(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusDryRun || len(provider.pullRequests) != 0 || len(gitRepo.pushed) != 0 {
+		t.Errorf("Expected nothing to change in dry run: %+v", result)
+	}
+	if !strings.Contains(out.String(), "Create pull request for feature-b into feature-a") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+}
+
+func TestWithStackSection(t *testing.T) {
+	section := stackStartMarker + "\nnew\n" + stackEndMarker
+
+	got := withStackSection("Body", section)
+	if got != "Body\n\n"+section {
+		t.Errorf("Expected section appended, got %q", got)
+	}
+
+	got = withStackSection("Body\n\n"+stackStartMarker+"\nold\n"+stackEndMarker+"\nFooter", section)
+	if got != "Body\n\n"+section+"\nFooter" {
+		t.Errorf("Expected section replaced, got %q", got)
+	}
+}
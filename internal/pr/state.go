@@ -0,0 +1,79 @@
+package pr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type State struct {
+	Requirements   *Requirements      `json:"requirements"`
+	OriginalBranch string             `json:"original_branch"`
+	BaseHead       string             `json:"base_head,omitempty"`
+	Completed      []string           `json:"completed"`
+	FailedStep     string             `json:"failed_step,omitempty"`
+	Error          string             `json:"error,omitempty"`
+	PullRequest    *PullRequestResult `json:"pull_request,omitempty"`
+}
+
+func (st *State) done(step string) bool {
+	return slices.Contains(st.Completed, step)
+}
+
+type StateStore interface {
+	Load() (*State, error)
+	Save(state *State) error
+	Clear() error
+}
+
+// FileStateStore keeps the state of an unfinished run in <git dir>/branchtale/state.json.
+type FileStateStore struct {
+	path string
+}
+
+func NewFileStateStore(gitDir string) *FileStateStore {
+	return &FileStateStore{path: filepath.Join(gitDir, "branchtale", "state.json")}
+}
+
+func (f *FileStateStore) Load() (*State, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode run state %s: %w", f.path, err)
+	}
+	if state.Requirements == nil {
+		return nil, fmt.Errorf("invalid run state %s: no requirements", f.path)
+	}
+	return &state, nil
+}
+
+func (f *FileStateStore) Save(state *State) error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run state: %w", err)
+	}
+	if err := os.WriteFile(f.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	return nil
+}
+
+func (f *FileStateStore) Clear() error {
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove run state: %w", err)
+	}
+	return nil
+}
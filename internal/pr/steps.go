@@ -0,0 +1,206 @@
+package pr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/vcs"
+	"github.com/fatih/color"
+)
+
+const (
+	StepCreateBranch      = "create_branch"
+	StepCheckoutBranch    = "checkout_branch"
+	StepPushBranch        = "push_branch"
+	StepResetBase         = "reset_base"
+	StepCreatePullRequest = "create_pull_request"
+	StepMergePullRequest  = "merge_pull_request"
+)
+
+type Step struct {
+	Name    string
+	Applies func(r *Requirements) bool
+	Run     func(ctx context.Context, e *execution) error
+}
+
+// execution is what a step gets to work with: the dependencies of the
+// service plus the persisted state of the run it belongs to.
+type execution struct {
+	config *config.Config
+	git    GitRepository
+	vcs    VCSProvider
+	out    io.Writer
+	state  *State
+	result *Result
+
+	owner string
+	repo  string
+}
+
+func workflowSteps() []Step {
+	return []Step{
+		{Name: StepCreateBranch, Applies: func(r *Requirements) bool { return r.CreateBranch }, Run: createBranchStep},
+		{Name: StepCheckoutBranch, Applies: func(r *Requirements) bool { return r.CreateBranch }, Run: checkoutBranchStep},
+		{Name: StepPushBranch, Applies: func(r *Requirements) bool { return r.PushBranch }, Run: pushBranchStep},
+		{Name: StepResetBase, Applies: func(r *Requirements) bool { return r.CreateBranch && r.ResetBase }, Run: resetBaseStep},
+		{Name: StepCreatePullRequest, Applies: func(r *Requirements) bool { return r.CreatePullRequest }, Run: createPullRequestStep},
+		{Name: StepMergePullRequest, Applies: func(r *Requirements) bool { return r.CreatePullRequest && r.MergePullRequest }, Run: mergePullRequestStep},
+	}
+}
+
+func (e *execution) repository(ctx context.Context) (string, string, error) {
+	if e.owner != "" {
+		return e.owner, e.repo, nil
+	}
+
+	owner, repo, err := remoteRepository(ctx, e.git)
+	if err != nil {
+		return "", "", err
+	}
+	e.owner, e.repo = owner, repo
+	e.result.Repository = owner + "/" + repo
+	return owner, repo, nil
+}
+
+func createBranchStep(ctx context.Context, e *execution) error {
+	r := e.state.Requirements
+	if err := e.git.CreateBranch(ctx, r.BranchName); err != nil {
+		return err
+	}
+	e.result.BranchCreated = true
+	fmt.Fprintf(e.out, "Created branch: %s\n", color.GreenString(r.BranchName))
+	return nil
+}
+
+func checkoutBranchStep(ctx context.Context, e *execution) error {
+	r := e.state.Requirements
+	if err := e.git.CheckoutBranch(ctx, r.BranchName); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Checked out branch: %s\n", color.GreenString(r.BranchName))
+	return nil
+}
+
+func pushBranchStep(ctx context.Context, e *execution) error {
+	r := e.state.Requirements
+	started := time.Now()
+	if err := e.git.PushBranch(ctx, r.BranchName, "origin"); err != nil {
+		return err
+	}
+	e.result.Pushed = true
+	e.result.Timings["push"] = time.Since(started).Milliseconds()
+	fmt.Fprintf(e.out, "Pushed branch: %s\n", color.GreenString(r.BranchName))
+	return nil
+}
+
+// resetBaseStep moves the local base branch back to its remote counterpart
+// after its commits were moved to the new branch. It refuses to do so unless
+// every commit on the local base branch is reachable from the new branch.
+func resetBaseStep(ctx context.Context, e *execution) error {
+	r := e.state.Requirements
+	remoteBase := "origin/" + r.BaseBranch
+
+	baseHead, err := e.git.ResolveRevision(ctx, r.BaseBranch)
+	if err != nil {
+		return err
+	}
+	reachable, err := e.git.IsAncestor(ctx, baseHead, r.BranchName)
+	if err != nil {
+		return err
+	}
+	if !reachable {
+		return fmt.Errorf("local %s has commits that are not on %s; not resetting it", r.BaseBranch, r.BranchName)
+	}
+
+	remoteHead, err := e.git.ResolveRevision(ctx, remoteBase)
+	if err != nil {
+		return err
+	}
+
+	e.state.BaseHead = baseHead
+	if err := e.git.ResetBranch(ctx, r.BaseBranch, remoteHead); err != nil {
+		return err
+	}
+	e.result.BaseReset = true
+	fmt.Fprintf(e.out, "Reset local %s to %s\n", color.GreenString(r.BaseBranch), color.GreenString(remoteBase))
+	return nil
+}
+
+// createPullRequestStep opens the pull request, or adopts an open one from
+// the same branch into the same base. A request that timed out may still
+// have created it, so a resumed run must not open it twice.
+func createPullRequestStep(ctx context.Context, e *execution) error {
+	r := e.state.Requirements
+	owner, repo, err := e.repository(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing, err := e.vcs.FindPullRequest(ctx, &vcs.FindPullRequestRequest{Owner: owner, Repo: repo, HeadBranch: r.BranchName})
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Open && existing.BaseBranch == r.BaseBranch {
+		e.state.PullRequest = &PullRequestResult{Number: existing.Number, URL: existing.URL}
+		e.result.PullRequest = e.state.PullRequest
+		fmt.Fprintf(e.out, "Pull Request already exists: %s\n", color.GreenString(existing.URL))
+		return nil
+	}
+
+	pr := &vcs.CreatePullRequestRequest{
+		Owner:       owner,
+		Repo:        repo,
+		Title:       r.PullRequestTitle,
+		Description: r.PullRequestDescription,
+		HeadBranch:  r.BranchName,
+		BaseBranch:  r.BaseBranch,
+	}
+	if e.config.Verbose {
+		fmt.Fprintf(e.out, "Creating Pull Request with this payload: %+v\n", pr)
+	}
+
+	started := time.Now()
+	response, err := e.vcs.CreatePullRequest(ctx, pr)
+	if err != nil {
+		return err
+	}
+	e.result.Timings["create_pull_request"] = time.Since(started).Milliseconds()
+	e.state.PullRequest = &PullRequestResult{Number: response.Number, URL: response.URL}
+	e.result.PullRequest = e.state.PullRequest
+	fmt.Fprintf(e.out, "Pull Request created: %s\n", color.GreenString(response.URL))
+	return nil
+}
+
+func mergePullRequestStep(ctx context.Context, e *execution) error {
+	if e.state.PullRequest == nil {
+		return fmt.Errorf("no pull request to merge")
+	}
+	owner, repo, err := e.repository(ctx)
+	if err != nil {
+		return err
+	}
+
+	number := e.state.PullRequest.Number
+	mergeReq := &vcs.MergePullRequestRequest{
+		Owner:       owner,
+		Repo:        repo,
+		Number:      number,
+		MergeMethod: "merge",
+	}
+	started := time.Now()
+	mergeResp, err := e.vcs.MergePullRequest(ctx, mergeReq)
+	if err != nil {
+		return err
+	}
+	e.result.Timings["merge_pull_request"] = time.Since(started).Milliseconds()
+	e.result.Merge = &MergeResult{Merged: mergeResp.Merged, SHA: mergeResp.SHA, Message: mergeResp.Message}
+	if mergeResp.Merged {
+		fmt.Fprintf(e.out, "Pull Request #%d merged successfully with SHA: %s\n", number, color.GreenString(mergeResp.SHA))
+	} else {
+		fmt.Fprintf(e.out, "Pull Request #%d was not merged. Message: %s\n", number, color.YellowString(mergeResp.Message))
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/vcs"
+)
+
+func newTestExecution(gitRepo *fakeGit, provider *fakeProvider, r *Requirements) *execution {
+	return &execution{
+		config: &config.Config{},
+		git:    gitRepo,
+		vcs:    provider,
+		out:    &bytes.Buffer{},
+		state:  &State{Requirements: r, OriginalBranch: gitRepo.current},
+		result: newResult(false),
+	}
+}
+
+func TestCreateBranchStep(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	e := newTestExecution(gitRepo, newFakeProvider(), &Requirements{BranchName: "feature/x"})
+
+	if err := createBranchStep(context.Background(), e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !gitRepo.localBranches["feature/x"] || !e.result.BranchCreated {
+		t.Error("Expected branch to be created")
+	}
+	if gitRepo.current != "main" {
+		t.Errorf("Expected to stay on main, got %s", gitRepo.current)
+	}
+}
+
+func TestCheckoutBranchStep(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	gitRepo.localBranches["feature/x"] = true
+	e := newTestExecution(gitRepo, newFakeProvider(), &Requirements{BranchName: "feature/x"})
+
+	if err := checkoutBranchStep(context.Background(), e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gitRepo.current != "feature/x" {
+		t.Errorf("Expected feature/x checked out, got %s", gitRepo.current)
+	}
+}
+
+func TestPushBranchStep(t *testing.T) {
+	gitRepo := newFakeGit("feature/x")
+	e := newTestExecution(gitRepo, newFakeProvider(), &Requirements{BranchName: "feature/x"})
+
+	if err := pushBranchStep(context.Background(), e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !gitRepo.remoteBranches["feature/x"] || !e.result.Pushed {
+		t.Error("Expected branch to be pushed")
+	}
+}
+
+func TestResetBaseStep(t *testing.T) {
+	gitRepo := newFakeGit("feature/x")
+	e := newTestExecution(gitRepo, newFakeProvider(), &Requirements{BranchName: "feature/x", BaseBranch: "main"})
+
+	if err := resetBaseStep(context.Background(), e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gitRepo.revisions["main"] != gitRepo.revisions["origin/main"] || !e.result.BaseReset {
+		t.Errorf("Expected main reset to origin/main, got %s", gitRepo.revisions["main"])
+	}
+	if e.state.BaseHead != "2222222222222222222222222222222222222222" {
+		t.Errorf("Expected previous main head recorded, got %s", e.state.BaseHead)
+	}
+}
+
+func TestResetBaseStep_refusesUnmovedCommits(t *testing.T) {
+	gitRepo := newFakeGit("feature/x")
+	gitRepo.diverged = true
+	e := newTestExecution(gitRepo, newFakeProvider(), &Requirements{BranchName: "feature/x", BaseBranch: "main"})
+
+	if err := resetBaseStep(context.Background(), e); err == nil {
+		t.Error("Expected reset to be refused")
+	}
+	if gitRepo.revisions["main"] != "2222222222222222222222222222222222222222" {
+		t.Error("Expected main to be left alone")
+	}
+}
+
+func TestCreatePullRequestStep(t *testing.T) {
+	provider := newFakeProvider()
+	e := newTestExecution(newFakeGit("feature/x"), provider, &Requirements{BranchName: "feature/x", BaseBranch: "main", PullRequestTitle: "Title"})
+
+	if err := createPullRequestStep(context.Background(), e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.state.PullRequest == nil || e.state.PullRequest.Number != 1 {
+		t.Fatalf("Expected pull request recorded in state, got %+v", e.state.PullRequest)
+	}
+	if e.result.Repository != "owner/repo" {
+		t.Errorf("Expected repository owner/repo, got %s", e.result.Repository)
+	}
+	if provider.pullRequests[0].Title != "Title" {
+		t.Errorf("Unexpected pull request: %+v", provider.pullRequests[0])
+	}
+}
+
+func TestMergePullRequestStep(t *testing.T) {
+	provider := newFakeProvider()
+	e := newTestExecution(newFakeGit("feature/x"), provider, &Requirements{BranchName: "feature/x"})
+
+	if err := mergePullRequestStep(context.Background(), e); err == nil {
+		t.Error("Expected error without a pull request")
+	}
+
+	if err := createPullRequestStep(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergePullRequestStep(context.Background(), e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !provider.pullRequests[0].Merged || e.result.Merge == nil || !e.result.Merge.Merged {
+		t.Error("Expected pull request to be merged")
+	}
+}
+
+func TestService_Run_resumesFailedStep(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	generator := newFakeGenerator()
+	provider := newFakeProvider()
+	store := &memoryStateStore{}
+	s := NewService(&config.Config{GitHubToken: "token"}, gitRepo, generator, provider, store)
+	s.out = &bytes.Buffer{}
+
+	gitRepo.errs["PushBranch"] = errors.New("network down")
+	if _, err := s.Run(context.Background()); err == nil {
+		t.Fatal("Expected push to fail")
+	}
+	if store.state == nil || store.state.FailedStep != StepPushBranch {
+		t.Fatalf("Expected state to record failed push, got %+v", store.state)
+	}
+	if strings.Join(store.state.Completed, ",") != "create_branch,checkout_branch" {
+		t.Errorf("Unexpected completed steps: %v", store.state.Completed)
+	}
+
+	delete(gitRepo.errs, "PushBranch")
+	callsBefore := generator.calls
+	result, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error on resume: %v", err)
+	}
+	if generator.calls != callsBefore {
+		t.Errorf("Expected resume not to regenerate content")
+	}
+	if result.Status != StatusCompleted || len(provider.pullRequests) != 1 {
+		t.Errorf("Expected resumed run to create the pull request: %+v", result)
+	}
+	if store.state != nil {
+		t.Errorf("Expected state to be cleared, got %+v", store.state)
+	}
+}
+
+func TestService_Run_resumeAdoptsCreatedPullRequest(t *testing.T) {
+	gitRepo := newFakeGit("feature/x")
+	provider := newFakeProvider()
+	store := &memoryStateStore{}
+	s := NewService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), provider, store)
+	s.out = &bytes.Buffer{}
+
+	provider.errs["CreatePullRequest"] = errors.New("context deadline exceeded")
+	if _, err := s.Run(context.Background()); err == nil {
+		t.Fatal("Expected creating the pull request to fail")
+	}
+	if store.state == nil || store.state.FailedStep != StepCreatePullRequest {
+		t.Fatalf("Expected state to record the failed step, got %+v", store.state)
+	}
+
+	// GitHub created the pull request although the request timed out.
+	delete(provider.errs, "CreatePullRequest")
+	provider.pullRequests = append(provider.pullRequests, &fakePullRequest{
+		CreatePullRequestRequest: vcs.CreatePullRequestRequest{HeadBranch: "feature/x", BaseBranch: "main", Title: "Add response cache"},
+		Number:                   1,
+	})
+	result, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error on resume: %v", err)
+	}
+	if len(provider.pullRequests) != 1 || result.PullRequest == nil || result.PullRequest.Number != 1 {
+		t.Errorf("Expected the existing pull request to be adopted, got %+v", result.PullRequest)
+	}
+	if !provider.pullRequests[0].Merged {
+		t.Error("Expected the adopted pull request to be merged")
+	}
+}
+
+func TestService_Run_resumeOnUnrelatedBranch(t *testing.T) {
+	store := &memoryStateStore{state: &State{
+		Requirements:   &Requirements{BranchName: "feature/x", CreateBranch: true},
+		OriginalBranch: "main",
+		Completed:      []string{StepCreateBranch},
+	}}
+	s := NewService(&config.Config{GitHubToken: "token"}, newFakeGit("other"), newFakeGenerator(), newFakeProvider(), store)
+	s.out = &bytes.Buffer{}
+
+	if _, err := s.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "--rollback") {
+		t.Errorf("Expected error pointing at --rollback, got %v", err)
+	}
+}
+
+func TestService_Rollback(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	provider := newFakeProvider()
+	provider.errs["CreatePullRequest"] = errors.New("api down")
+	store := &memoryStateStore{}
+	s := NewService(&config.Config{GitHubToken: "token"}, gitRepo, newFakeGenerator(), provider, store)
+	s.out = &bytes.Buffer{}
+
+	if _, err := s.Run(context.Background()); err == nil {
+		t.Fatal("Expected pull request creation to fail")
+	}
+	if gitRepo.current != "add-response-cache" || !gitRepo.remoteBranches["add-response-cache"] {
+		t.Fatalf("Expected branch created and pushed before failure")
+	}
+
+	result, err := s.Rollback(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusRolledBack {
+		t.Errorf("Expected rolled_back status, got %s", result.Status)
+	}
+	if gitRepo.current != "main" {
+		t.Errorf("Expected original branch restored, got %s", gitRepo.current)
+	}
+	if gitRepo.localBranches["add-response-cache"] || gitRepo.remoteBranches["add-response-cache"] {
+		t.Error("Expected created branches to be deleted")
+	}
+	if store.state != nil {
+		t.Error("Expected state to be cleared")
+	}
+}
+
+func TestService_Rollback_restoresBase(t *testing.T) {
+	gitRepo := newFakeGit("main")
+	provider := newFakeProvider()
+	provider.errs["CreatePullRequest"] = errors.New("api down")
+	store := &memoryStateStore{}
+	s := NewService(&config.Config{GitHubToken: "token", ResetBase: true}, gitRepo, newFakeGenerator(), provider, store)
+	s.out = &bytes.Buffer{}
+
+	if _, err := s.Run(context.Background()); err == nil {
+		t.Fatal("Expected pull request creation to fail")
+	}
+	if gitRepo.revisions["main"] != gitRepo.revisions["origin/main"] {
+		t.Fatal("Expected main to be reset before failure")
+	}
+
+	if _, err := s.Rollback(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gitRepo.revisions["main"] != "2222222222222222222222222222222222222222" {
+		t.Errorf("Expected main restored, got %s", gitRepo.revisions["main"])
+	}
+}
+
+func TestService_Rollback_refusesAfterPullRequest(t *testing.T) {
+	store := &memoryStateStore{state: &State{
+		Requirements: &Requirements{BranchName: "feature/x"},
+		Completed:    []string{StepPushBranch, StepCreatePullRequest},
+		PullRequest:  &PullRequestResult{Number: 7, URL: "https://github.com/owner/repo/pull/7"},
+	}}
+	s := NewService(&config.Config{}, newFakeGit("feature/x"), newFakeGenerator(), newFakeProvider(), store)
+	s.out = &bytes.Buffer{}
+
+	if _, err := s.Rollback(context.Background()); err == nil {
+		t.Error("Expected rollback to be refused once a pull request exists")
+	}
+}
+
+func TestFileStateStore(t *testing.T) {
+	store := NewFileStateStore(t.TempDir())
+
+	state, err := store.Load()
+	if err != nil || state != nil {
+		t.Fatalf("Expected no state, got %+v, %v", state, err)
+	}
+
+	if err := store.Save(&State{Requirements: &Requirements{BranchName: "feature/x"}, Completed: []string{StepCreateBranch}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	state, err = store.Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.Requirements.BranchName != "feature/x" || !state.done(StepCreateBranch) {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state, _ := store.Load(); state != nil {
+		t.Error("Expected state to be cleared")
+	}
+}
@@ -0,0 +1,141 @@
+package pr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/git"
+	"github.com/fatih/color"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// findTicket returns the first ticket key in sources that matches the
+// configured pattern. If the pattern has a capturing group, its first match
+// is the key.
+func (s *Service) findTicket(sources ...string) string {
+	pattern := s.config.TicketPattern
+	if pattern == "" {
+		pattern = config.DefaultTicketPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return ""
+	}
+
+	for _, source := range sources {
+		m := re.FindStringSubmatch(source)
+		if m == nil {
+			continue
+		}
+		if len(m) > 1 && m[1] != "" {
+			return m[1]
+		}
+		return m[0]
+	}
+	return ""
+}
+
+func (s *Service) contentInput(ctx context.Context, diffInfo *git.DiffInfo, branch string) *ai.Input {
+	return s.newInput(ctx, diffInfo.Diff, diffInfo.Files, commitMessages(diffInfo.Commits), branch)
+}
+
+// newInput collects what content is generated from. The ticket is looked up
+// in the branch name and the prefix. Commit messages are only searched with a
+// configured ticket pattern, since the default one also matches words such
+// as UTF-8 there; merge commits, which name pull requests as #N, are always
+// skipped. The issue is fetched only when enabled and the tracker has issues for the key,
+// and a failed fetch is not fatal.
+func (s *Service) newInput(ctx context.Context, diff string, files, messages []string, branch string) *ai.Input {
+	input := &ai.Input{Diff: diff, Files: files, Branch: branch, Language: config.Languages[s.config.Language]}
+	for _, message := range messages {
+		subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+		input.Commits = append(input.Commits, subject)
+	}
+	if s.config.TitleStyle == config.TitleStyleConventional {
+		input.Conventional = inferConventional(input.Commits, files)
+	}
+	sources := []string{branch, s.config.BranchPrefix}
+	if pattern := s.config.TicketPattern; pattern != "" && pattern != config.DefaultTicketPattern {
+		for _, message := range messages {
+			if !strings.HasPrefix(message, "Merge ") {
+				sources = append(sources, message)
+			}
+		}
+	}
+	input.Ticket = s.findTicket(sources...)
+
+	if input.Ticket == "" || s.tracker == nil || !s.config.FetchIssues || s.tracker.IssueURL(input.Ticket) == "" {
+		return input
+	}
+	issue, err := s.tracker.FetchIssue(ctx, input.Ticket)
+	if err != nil {
+		fmt.Fprintln(s.out, color.YellowString("Could not fetch issue %s: %v", input.Ticket, err))
+		return input
+	}
+	input.Issue = &ai.Issue{Key: issue.Key, Title: issue.Title, Body: issue.Body, URL: issue.URL}
+	if s.config.Verbose {
+		fmt.Fprintf(s.out, "Using issue %s: %s\n", color.GreenString(issue.Key), issue.Title)
+	}
+	return input
+}
+
+// commitMessages returns the full commit messages, oldest first.
+func commitMessages(commits []*object.Commit) []string {
+	var messages []string
+	for _, commit := range slices.Backward(commits) {
+		messages = append(messages, commit.Message)
+	}
+	return messages
+}
+
+// withTicketTitle puts the ticket into a generated title following the
+// title template, unless the title already mentions it.
+func (s *Service) withTicketTitle(title, ticket string) string {
+	if title == "" || ticket == "" || strings.Contains(title, ticket) {
+		return title
+	}
+	template := s.config.TitleTemplate
+	if template == "" {
+		template = "{title}"
+	}
+	return strings.NewReplacer("{ticket}", ticket, "{title}", title).Replace(template)
+}
+
+// ticketLink is the line added to descriptions: a reference to GitHub issues,
+// a link to the configured tracker otherwise. Only an issue named in the
+// branch name or the prefix is closed; one mentioned in a commit message may
+// just be related.
+func (s *Service) ticketLink(input *ai.Input) string {
+	switch {
+	case input.Ticket == "":
+		return ""
+	case strings.HasPrefix(input.Ticket, "#"):
+		if s.findTicket(input.Branch, s.config.BranchPrefix) == input.Ticket {
+			return "Closes " + input.Ticket
+		}
+		return "Refs " + input.Ticket
+	case input.Issue != nil && input.Issue.URL != "":
+		return fmt.Sprintf("Ticket: [%s](%s)", input.Ticket, input.Issue.URL)
+	case s.tracker != nil:
+		if url := s.tracker.IssueURL(input.Ticket); url != "" {
+			return fmt.Sprintf("Ticket: [%s](%s)", input.Ticket, url)
+		}
+	}
+	return ""
+}
+
+func (s *Service) withTicketLink(description string, input *ai.Input) string {
+	link := s.ticketLink(input)
+	if link == "" || strings.Contains(description, link) {
+		return description
+	}
+	if strings.TrimSpace(description) == "" {
+		return link
+	}
+	return strings.TrimRight(description, "\n") + "\n\n" + link
+}
@@ -0,0 +1,144 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/deck/branchtale/internal/ai"
+	"github.com/deck/branchtale/internal/config"
+	"github.com/deck/branchtale/internal/tracker"
+)
+
+func TestService_findTicket(t *testing.T) {
+	tests := []struct {
+		pattern string
+		sources []string
+		want    string
+	}{
+		{"", []string{"feature/PROJ-123-add-cache"}, "PROJ-123"},
+		{"", []string{"", "feature/", "Fix crash\n\nFixes #42"}, "#42"},
+		{"", []string{"add-cache", "", "no ticket here"}, ""},
+		{`ticket-([0-9]+)`, []string{"ticket-77-cache"}, "77"},
+		{"", []string{"A-1-fix", "add-utf8-and-sha256"}, ""},
+	}
+
+	for _, tt := range tests {
+		s := newTestService(&config.Config{TicketPattern: tt.pattern}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+		if got := s.findTicket(tt.sources...); got != tt.want {
+			t.Errorf("findTicket(%q) = %q, want %q", tt.sources, got, tt.want)
+		}
+	}
+}
+
+func TestService_withTicketTitle(t *testing.T) {
+	s := newTestService(&config.Config{TitleTemplate: "{ticket}: {title}"}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+
+	if got := s.withTicketTitle("Add cache", "PROJ-1"); got != "PROJ-1: Add cache" {
+		t.Errorf("Expected ticket in title, got %q", got)
+	}
+	if got := s.withTicketTitle("PROJ-1 Add cache", "PROJ-1"); got != "PROJ-1 Add cache" {
+		t.Errorf("Expected title that mentions the ticket to be kept, got %q", got)
+	}
+	if got := s.withTicketTitle("Add cache", ""); got != "Add cache" {
+		t.Errorf("Expected title without ticket to be kept, got %q", got)
+	}
+}
+
+func TestService_withTicketLink(t *testing.T) {
+	s := newTestService(&config.Config{}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	s.SetIssueTracker(tracker.NewJira("https://jira.example.com", "", ""))
+
+	if got := s.withTicketLink("Adds a cache.\n", &ai.Input{Ticket: "#42", Branch: "fix/#42-cache"}); got != "Adds a cache.\n\nCloses #42" {
+		t.Errorf("Expected closing keyword, got %q", got)
+	}
+	if got := s.withTicketLink("Adds a cache.", &ai.Input{Ticket: "#42", Branch: "add-cache"}); got != "Adds a cache.\n\nRefs #42" {
+		t.Errorf("Expected a reference to an issue from a commit message, got %q", got)
+	}
+	want := "Adds a cache.\n\nTicket: [PROJ-1](https://jira.example.com/browse/PROJ-1)"
+	if got := s.withTicketLink("Adds a cache.", &ai.Input{Ticket: "PROJ-1"}); got != want {
+		t.Errorf("Expected tracker link, got %q", got)
+	}
+	if got := s.withTicketLink(want, &ai.Input{Ticket: "PROJ-1"}); got != want {
+		t.Errorf("Expected the link not to be added twice, got %q", got)
+	}
+}
+
+func TestService_withTicketLink_gitHubTracker(t *testing.T) {
+	s := newTestService(&config.Config{FetchIssues: true}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	s.SetIssueTracker(tracker.NewGitHubIssues(nil, "owner", "repo"))
+
+	input := s.newInput(context.Background(), "diff", nil, nil, "PROJ-123-add-cache")
+	if input.Ticket != "PROJ-123" || input.Issue != nil {
+		t.Errorf("Expected the ticket without fetching it, got %+v", input)
+	}
+	if out := s.out.(*bytes.Buffer).String(); out != "" {
+		t.Errorf("Expected no fetch warning, got %q", out)
+	}
+	if got := s.withTicketLink("Adds a cache.", input); got != "Adds a cache." {
+		t.Errorf("Expected no link for a key that is not a GitHub issue, got %q", got)
+	}
+}
+
+func TestService_newInput_commitTickets(t *testing.T) {
+	messages := []string{"Merge pull request #45 from owner/cache", "Encode keys as UTF-8\n\nHash them with SHA-256 (ISO-8601 dates), see PROJ-7"}
+
+	s := newTestService(&config.Config{TicketPattern: config.DefaultTicketPattern}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	if input := s.newInput(context.Background(), "diff", nil, messages, ""); input.Ticket != "" {
+		t.Errorf("expected commit messages to be ignored with the default pattern, got %q", input.Ticket)
+	}
+	if input := s.newInput(context.Background(), "diff", nil, messages, "PROJ-9-cache"); input.Ticket != "PROJ-9" {
+		t.Errorf("expected the ticket of the branch, got %q", input.Ticket)
+	}
+
+	s = newTestService(&config.Config{TicketPattern: `#[0-9]+|PROJ-[0-9]+`}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	if input := s.newInput(context.Background(), "diff", nil, messages, ""); input.Ticket != "PROJ-7" {
+		t.Errorf("expected the configured key from a commit message, skipping the merge, got %q", input.Ticket)
+	}
+}
+
+func TestService_newInput_fetchesIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/PROJ-123" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"key":"PROJ-123","fields":{"summary":"Cache API responses","description":"Responses are slow."}}`))
+	}))
+	defer server.Close()
+
+	s := newTestService(&config.Config{BranchPrefix: "feature/PROJ-123-", FetchIssues: true}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	s.SetIssueTracker(tracker.NewJira(server.URL, "", "token"))
+
+	input := s.newInput(context.Background(), "diff", nil, []string{"Add cache\n\nDetails"}, "")
+	if input.Ticket != "PROJ-123" {
+		t.Errorf("Expected ticket from the prefix, got %q", input.Ticket)
+	}
+	if len(input.Commits) != 1 || input.Commits[0] != "Add cache" {
+		t.Errorf("Expected commit subjects, got %v", input.Commits)
+	}
+	if input.Issue == nil || input.Issue.Title != "Cache API responses" || input.Issue.URL != server.URL+"/browse/PROJ-123" {
+		t.Fatalf("Expected the issue to be fetched, got %+v", input.Issue)
+	}
+}
+
+func TestService_newInput_fetchFailureIsNotFatal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	s := newTestService(&config.Config{FetchIssues: true}, newFakeGit("main"), newFakeGenerator(), newFakeProvider())
+	s.SetIssueTracker(tracker.NewJira(server.URL, "", "token"))
+
+	input := s.newInput(context.Background(), "diff", nil, nil, "PROJ-9-fix")
+	if input.Ticket != "PROJ-9" || input.Issue != nil {
+		t.Errorf("Expected ticket without issue, got %+v", input)
+	}
+	if !strings.Contains(s.out.(*bytes.Buffer).String(), "Could not fetch issue PROJ-9") {
+		t.Error("Expected a warning about the failed fetch")
+	}
+}
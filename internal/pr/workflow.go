@@ -2,115 +2,189 @@ package pr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
-	"github.com/deck/branchtale/internal/config"
-	"github.com/deck/branchtale/internal/git"
 	"github.com/deck/branchtale/internal/vcs"
 	"github.com/fatih/color"
 )
 
 type Requirements struct {
-	CreateBranch           bool
-	PushBranch             bool
-	BranchName             string
-	BaseBranch             string
-	CreatePullRequest      bool
-	MergePullRequest       bool
-	PullRequestTitle       string
-	PullRequestDescription string
-	PullRequestTags        []string
+	CreateBranch           bool     `json:"create_branch"`
+	PushBranch             bool     `json:"push_branch"`
+	BranchName             string   `json:"branch_name"`
+	BaseBranch             string   `json:"base_branch"`
+	CreatePullRequest      bool     `json:"create_pull_request"`
+	MergePullRequest       bool     `json:"merge_pull_request"`
+	PullRequestTitle       string   `json:"pull_request_title"`
+	PullRequestDescription string   `json:"pull_request_description"`
+	PullRequestTags        []string `json:"pull_request_tags,omitempty"`
+	ResetBase              bool     `json:"reset_base,omitempty"`
 }
 
-func Execute(ctx context.Context, reqs *Requirements, gitRepo *git.Repository, cfg *config.Config) error {
-	vcsProvider := vcs.NewGitHubProvider(cfg.GitHubToken)
+func (s *Service) Execute(ctx context.Context, reqs *Requirements, result *Result) error {
+	result.Plan = reqs
+	result.BaseBranch = reqs.BaseBranch
+	result.HeadBranch = reqs.BranchName
 
-	if cfg.DryRun {
-		return DryExecute(ctx, reqs, gitRepo, cfg)
+	if reqs.CreatePullRequest {
+		if err := s.checkTitle(reqs.PullRequestTitle); err != nil {
+			return err
+		}
 	}
 
-	if reqs.CreateBranch {
-		if err := gitRepo.CreateBranch(ctx, reqs.BranchName); err != nil {
+	if s.config.DryRun {
+		return s.DryExecute(ctx, reqs, result)
+	}
+
+	if reqs.CreatePullRequest {
+		if err := s.config.RequireGitHubToken(); err != nil {
 			return err
 		}
-		fmt.Printf("Created branch: %s\n", color.GreenString(reqs.BranchName))
+	}
+
+	repoInfo, err := s.git.GetInfo()
+	if err != nil {
+		return err
+	}
 
-		if err := gitRepo.CheckoutBranch(ctx, reqs.BranchName); err != nil {
+	state := &State{Requirements: reqs, OriginalBranch: repoInfo.CurrentBranch}
+	return s.runSteps(ctx, state, result)
+}
+
+// runSteps runs every applicable step that has not completed yet and records
+// progress after each one, so a failed run can be resumed or rolled back.
+func (s *Service) runSteps(ctx context.Context, state *State, result *Result) error {
+	e := &execution{
+		config: s.config,
+		git:    s.git,
+		vcs:    s.vcs,
+		out:    s.out,
+		state:  state,
+		result: result,
+	}
+	result.PullRequest = state.PullRequest
+
+	for _, step := range workflowSteps() {
+		if !step.Applies(state.Requirements) || state.done(step.Name) {
+			continue
+		}
+
+		if err := step.Run(ctx, e); err != nil {
+			state.FailedStep = step.Name
+			state.Error = err.Error()
+			if saveErr := s.state.Save(state); saveErr != nil {
+				return errors.Join(err, saveErr)
+			}
+			fmt.Fprintf(s.out, "Step %s failed. Rerun branchtale to resume from it, or run with --rollback to undo.\n", color.YellowString(step.Name))
 			return err
 		}
-		fmt.Printf("Checked out branch: %s\n", color.GreenString(reqs.BranchName))
-	}
 
-	if reqs.PushBranch {
-		if err := gitRepo.PushBranch(ctx, reqs.BranchName, "origin"); err != nil {
+		state.Completed = append(state.Completed, step.Name)
+		state.FailedStep, state.Error = "", ""
+		if err := s.state.Save(state); err != nil {
 			return err
 		}
-		fmt.Printf("Pushed branch: %s\n", color.GreenString(reqs.BranchName))
 	}
 
-	remoteUrl, err := gitRepo.GetRemoteUrl(ctx, "origin")
+	result.Status = StatusCompleted
+	return s.state.Clear()
+}
+
+func (s *Service) resume(ctx context.Context, state *State, result *Result) error {
+	r := state.Requirements
+	result.Plan = r
+	result.BaseBranch = r.BaseBranch
+	result.HeadBranch = r.BranchName
+
+	repoInfo, err := s.git.GetInfo()
 	if err != nil {
 		return err
 	}
+	if repoInfo.CurrentBranch != state.OriginalBranch && repoInfo.CurrentBranch != r.BranchName {
+		return fmt.Errorf("an unfinished run for branch %s exists; switch to %s to resume it or run with --rollback", r.BranchName, state.OriginalBranch)
+	}
 
-	owner, repo, err := vcs.ParseGitHubURL(remoteUrl)
+	if r.CreatePullRequest {
+		if err := s.config.RequireGitHubToken(); err != nil {
+			return err
+		}
+	}
+
+	from := state.FailedStep
+	if from == "" {
+		from = "the next step"
+	}
+	fmt.Fprintf(s.out, "Resuming unfinished run for branch %s from %s\n", color.GreenString(r.BranchName), color.YellowString(from))
+	return s.runSteps(ctx, state, result)
+}
+
+// Rollback undoes the local and remote changes of an unfinished run: it
+// returns to the original branch and deletes the branches the run created.
+func (s *Service) Rollback(ctx context.Context) (*Result, error) {
+	result := newResult(s.config.DryRun)
+
+	state, err := s.state.Load()
 	if err != nil {
-		return err
+		return result, err
+	}
+	if state == nil {
+		fmt.Fprintln(s.out, "Nothing to roll back.")
+		result.Status = StatusRolledBack
+		return result, nil
 	}
 
-	if reqs.CreatePullRequest {
-		pr := &vcs.CreatePullRequestRequest{
-			Owner:       owner,
-			Repo:        repo,
-			Title:       reqs.PullRequestTitle,
-			Description: reqs.PullRequestDescription,
-			HeadBranch:  reqs.BranchName,
-			BaseBranch:  reqs.BaseBranch,
+	r := state.Requirements
+	result.Plan = r
+	result.BaseBranch = r.BaseBranch
+	result.HeadBranch = r.BranchName
+	if state.PullRequest != nil {
+		return result, fmt.Errorf("pull request #%d was already created (%s); close it on GitHub instead of rolling back", state.PullRequest.Number, state.PullRequest.URL)
+	}
+
+	if state.done(StepResetBase) {
+		if err := s.git.ResetBranch(ctx, r.BaseBranch, state.BaseHead); err != nil {
+			return result, err
 		}
-		if cfg.Verbose {
-			fmt.Printf("Creating Pull Request with this payload: %+v\n", pr)
+		fmt.Fprintf(s.out, "Restored local %s\n", color.GreenString(r.BaseBranch))
+	}
+	if state.done(StepPushBranch) {
+		if err := s.git.DeleteRemoteBranch(ctx, r.BranchName, "origin"); err != nil {
+			return result, err
 		}
-
-		response, err := vcsProvider.CreatePullRequest(ctx, pr)
-		if err != nil {
-			return err
+		fmt.Fprintf(s.out, "Deleted remote branch: %s\n", color.YellowString(r.BranchName))
+	}
+	if state.done(StepCheckoutBranch) {
+		if err := s.git.CheckoutBranch(ctx, state.OriginalBranch); err != nil {
+			return result, err
 		}
-		fmt.Printf("Pull Request created: %s\n", color.GreenString(response.URL))
-
-		if reqs.MergePullRequest {
-			mergeReq := &vcs.MergePullRequestRequest{
-				Owner:       owner,
-				Repo:        repo,
-				Number:      response.Number,
-				MergeMethod: "merge",
-			}
-			mergeResp, err := vcsProvider.MergePullRequest(ctx, mergeReq)
-
-			if err != nil {
-				return err
-			}
-			if mergeResp.Merged {
-				fmt.Printf("Pull Request #%d merged successfully with SHA: %s\n", response.Number, color.GreenString(mergeResp.SHA))
-			} else {
-				fmt.Printf("Pull Request #%d was not merged. Message: %s\n", response.Number, color.YellowString(mergeResp.Message))
-			}
+		fmt.Fprintf(s.out, "Checked out branch: %s\n", color.GreenString(state.OriginalBranch))
+	}
+	if state.done(StepCreateBranch) {
+		if err := s.git.DeleteBranch(ctx, r.BranchName); err != nil {
+			return result, err
 		}
+		fmt.Fprintf(s.out, "Deleted branch: %s\n", color.YellowString(r.BranchName))
 	}
 
-	return nil
+	result.Status = StatusRolledBack
+	return result, s.state.Clear()
 }
 
-func DryExecute(ctx context.Context, reqs *Requirements, gitRepo *git.Repository, cfg *config.Config) error {
-	fmt.Println("Dry run mode enabled. The following actions would be performed:")
+func (s *Service) DryExecute(ctx context.Context, reqs *Requirements, result *Result) error {
+	fmt.Fprintln(s.out, "Dry run mode enabled. The following actions would be performed:")
 	if reqs.CreateBranch {
-		fmt.Printf("- Create branch: %s\n", color.GreenString(reqs.BranchName))
-		fmt.Printf("- Checkout branch: %s\n", color.GreenString(reqs.BranchName))
+		fmt.Fprintf(s.out, "- Create branch: %s\n", color.GreenString(reqs.BranchName))
+		fmt.Fprintf(s.out, "- Checkout branch: %s\n", color.GreenString(reqs.BranchName))
 	}
 	if reqs.PushBranch {
-		fmt.Printf("- Push branch: %s to remote 'origin'\n", color.GreenString(reqs.BranchName))
+		fmt.Fprintf(s.out, "- Push branch: %s to remote 'origin'\n", color.GreenString(reqs.BranchName))
+	}
+	if reqs.CreateBranch && reqs.ResetBase {
+		fmt.Fprintf(s.out, "- Reset local %s to origin/%s\n", color.GreenString(reqs.BaseBranch), color.GreenString(reqs.BaseBranch))
 	}
 	if reqs.CreatePullRequest {
-		remoteUrl, err := gitRepo.GetRemoteUrl(ctx, "origin")
+		remoteUrl, err := s.git.GetRemoteUrl(ctx, "origin")
 		if err != nil {
 			return err
 		}
@@ -119,12 +193,14 @@ func DryExecute(ctx context.Context, reqs *Requirements, gitRepo *git.Repository
 		if err != nil {
 			return err
 		}
+		result.Repository = owner + "/" + repo
 
-		fmt.Printf("- Create Pull Request in repository %s/%s\n", color.GreenString(owner), color.GreenString(repo))
-		fmt.Printf("  - Title: %s\n", color.GreenString(reqs.PullRequestTitle))
-		fmt.Printf("  - Description: %s\n", color.GreenString(reqs.PullRequestDescription))
-		fmt.Printf("  - Head Branch: %s\n", color.GreenString(reqs.BranchName))
-		fmt.Printf("  - Base Branch: %s\n", color.GreenString(reqs.BaseBranch))
+		fmt.Fprintf(s.out, "- Create Pull Request in repository %s/%s\n", color.GreenString(owner), color.GreenString(repo))
+		fmt.Fprintf(s.out, "  - Title: %s\n", color.GreenString(reqs.PullRequestTitle))
+		fmt.Fprintf(s.out, "  - Description: %s\n", color.GreenString(reqs.PullRequestDescription))
+		fmt.Fprintf(s.out, "  - Head Branch: %s\n", color.GreenString(reqs.BranchName))
+		fmt.Fprintf(s.out, "  - Base Branch: %s\n", color.GreenString(reqs.BaseBranch))
 	}
+	result.Status = StatusDryRun
 	return nil
 }
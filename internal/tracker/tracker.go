@@ -0,0 +1,131 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/deck/branchtale/internal/httpclient"
+	"github.com/google/go-github/v74/github"
+	"golang.org/x/oauth2"
+)
+
+type Issue struct {
+	Key   string
+	Title string
+	Body  string
+	URL   string
+}
+
+type Tracker interface {
+	FetchIssue(ctx context.Context, key string) (*Issue, error)
+	// IssueURL links to an issue without fetching it. It is empty for keys
+	// the tracker has no issues for.
+	IssueURL(key string) string
+}
+
+type GitHubIssues struct {
+	client *github.Client
+	owner  string
+	repo   string
+}
+
+func NewGitHubIssues(ts oauth2.TokenSource, owner, repo string) *GitHubIssues {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpclient.New(httpclient.Options{}))
+	return &GitHubIssues{client: github.NewClient(oauth2.NewClient(ctx, ts)), owner: owner, repo: repo}
+}
+
+func (g *GitHubIssues) FetchIssue(ctx context.Context, key string) (*Issue, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(key, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub issue number %q", key)
+	}
+
+	issue, _, err := g.client.Issues.Get(ctx, g.owner, g.repo, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch issue #%d: %w", number, err)
+	}
+	return &Issue{
+		Key:   fmt.Sprintf("#%d", number),
+		Title: issue.GetTitle(),
+		Body:  issue.GetBody(),
+		URL:   issue.GetHTMLURL(),
+	}, nil
+}
+
+// IssueURL links only #N keys: other keys, such as PROJ-123, are not
+// GitHub issues.
+func (g *GitHubIssues) IssueURL(key string) string {
+	number, ok := strings.CutPrefix(key, "#")
+	if _, err := strconv.Atoi(number); !ok || err != nil {
+		return ""
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/issues/%s", g.owner, g.repo, number)
+}
+
+// Jira talks to the REST API v2 of Jira or a compatible tracker. With a user
+// the token is sent as basic auth (Jira Cloud), otherwise as a bearer token
+// (Jira Server/Data Center personal access tokens).
+type Jira struct {
+	baseURL string
+	user    string
+	token   string
+	client  *http.Client
+}
+
+func NewJira(baseURL, user, token string) *Jira {
+	return &Jira{baseURL: strings.TrimRight(baseURL, "/"), user: user, token: token, client: httpclient.New(httpclient.Options{})}
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+	} `json:"fields"`
+}
+
+func (j *Jira) FetchIssue(ctx context.Context, key string) (*Issue, error) {
+	endpoint := fmt.Sprintf("%s/rest/api/2/issue/%s?fields=summary,description", j.baseURL, url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if j.user != "" {
+		req.SetBasicAuth(j.user, j.token)
+	} else if j.token != "" {
+		req.Header.Set("Authorization", "Bearer "+j.token)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch issue %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to fetch issue %s: status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var issue jiraIssue
+	if err := json.NewDecoder(resp.Body).Decode(&issue); err != nil {
+		return nil, fmt.Errorf("failed to decode issue %s: %w", key, err)
+	}
+	return &Issue{
+		Key:   issue.Key,
+		Title: issue.Fields.Summary,
+		Body:  issue.Fields.Description,
+		URL:   j.IssueURL(issue.Key),
+	}, nil
+}
+
+func (j *Jira) IssueURL(key string) string {
+	return j.baseURL + "/browse/" + key
+}
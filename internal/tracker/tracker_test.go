@@ -0,0 +1,96 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v74/github"
+)
+
+func TestJira_FetchIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/PROJ-123" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if user, token, ok := r.BasicAuth(); !ok || user != "me@example.com" || token != "secret" {
+			t.Errorf("expected basic auth, got %q", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `{"key": "PROJ-123", "fields": {"summary": "Cache responses", "description": "Responses are slow."}}`)
+	}))
+	defer server.Close()
+
+	issue, err := NewJira(server.URL+"/", "me@example.com", "secret").FetchIssue(context.Background(), "PROJ-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issue.Title != "Cache responses" || issue.Body != "Responses are slow." {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+	if issue.URL != server.URL+"/browse/PROJ-123" {
+		t.Errorf("unexpected issue URL %s", issue.URL)
+	}
+}
+
+func TestJira_FetchIssue_bearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `{"key": "PROJ-1", "fields": {"summary": "x"}}`)
+	}))
+	defer server.Close()
+
+	if _, err := NewJira(server.URL, "", "secret").FetchIssue(context.Background(), "PROJ-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestJira_FetchIssue_notFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errorMessages":["Issue does not exist"]}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, err := NewJira(server.URL, "", "secret").FetchIssue(context.Background(), "PROJ-404"); err == nil {
+		t.Error("expected error for missing issue")
+	}
+}
+
+func TestGitHubIssues_FetchIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/issues/42" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"number": 42, "title": "Cache responses", "body": "Responses are slow.", "html_url": "https://github.com/owner/repo/issues/42"}`)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	issues := &GitHubIssues{client: client, owner: "owner", repo: "repo"}
+
+	issue, err := issues.FetchIssue(context.Background(), "#42")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issue.Key != "#42" || issue.Title != "Cache responses" || issue.URL != "https://github.com/owner/repo/issues/42" {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+}
+
+func TestGitHubIssues_IssueURL(t *testing.T) {
+	issues := &GitHubIssues{owner: "owner", repo: "repo"}
+
+	if got := issues.IssueURL("#42"); got != "https://github.com/owner/repo/issues/42" {
+		t.Errorf("unexpected URL: %q", got)
+	}
+	for _, key := range []string{"PROJ-123", "42", "#abc"} {
+		if got := issues.IssueURL(key); got != "" {
+			t.Errorf("expected no URL for %q, got %q", key, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// AppendLog adds records to the JSON lines log at path.
+func AppendLog(path string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create usage log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write usage log: %w", err)
+		}
+	}
+	return file.Close()
+}
+
+// ReadLog returns the records in the log at path; a missing log has none.
+// Lines that cannot be read are skipped.
+func ReadLog(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return records, nil
+}
+
+// Period is the usage of one month, in total and per model.
+type Period struct {
+	Month  string
+	Total  *Summary
+	Models map[string]*Summary
+}
+
+// Monthly groups records by month, oldest first, in local time.
+func Monthly(records []Record) []*Period {
+	periods := map[string]*Period{}
+	for _, record := range records {
+		month := record.Time.Local().Format("2006-01")
+		period, ok := periods[month]
+		if !ok {
+			period = &Period{Month: month, Total: &Summary{}, Models: map[string]*Summary{}}
+			periods[month] = period
+		}
+		period.Total.Add(record)
+		if period.Models[record.Model] == nil {
+			period.Models[record.Model] = &Summary{}
+		}
+		period.Models[record.Model].Add(record)
+	}
+
+	var result []*Period
+	for _, period := range periods {
+		result = append(result, period)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Month < result[j].Month })
+	return result
+}
@@ -0,0 +1,48 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "usage.jsonl")
+	cost := 0.5
+	september := time.Date(2026, 9, 15, 12, 0, 0, 0, time.Local)
+	october := time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)
+
+	if records, err := ReadLog(path); err != nil || len(records) != 0 {
+		t.Errorf("Expected a missing log to be empty, got %v, %v", records, err)
+	}
+	if err := AppendLog(path, []Record{{Time: october, Model: "yandexgpt", InputTokens: 100, Cost: &cost}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := AppendLog(path, []Record{{Time: september, Model: "yandexgpt-lite", InputTokens: 10}, {Time: october, Model: "yandexgpt", OutputTokens: 5, Cost: &cost}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	file.WriteString("not json\n")
+	file.Close()
+
+	records, err := ReadLog(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+
+	periods := Monthly(records)
+	if len(periods) != 2 || periods[0].Month != "2026-09" || periods[1].Month != "2026-10" {
+		t.Fatalf("Unexpected periods: %+v", periods)
+	}
+	total := periods[1].Total
+	if total.Requests != 2 || total.InputTokens != 100 || total.OutputTokens != 5 || total.Cost != 1 {
+		t.Errorf("Unexpected October total: %+v", total)
+	}
+	if periods[0].Total.Unpriced != 1 || periods[0].Models["yandexgpt-lite"].Requests != 1 {
+		t.Errorf("Unexpected September usage: %+v", periods[0])
+	}
+}
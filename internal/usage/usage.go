@@ -0,0 +1,160 @@
+// Package usage counts the tokens spent on generation, estimates what they
+// cost and keeps a log of it for monthly reports.
+package usage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+)
+
+// Prices are per 1000 tokens, input and output alike, keyed by model name,
+// or by model name and mode as in "yandexgpt:async".
+type Prices map[string]float64
+
+// DefaultPrices are the YandexGPT list prices in rubles at the time of
+// writing; asynchronous requests cost half.
+var DefaultPrices = Prices{
+	"yandexgpt-lite":       0.2,
+	"yandexgpt-lite:async": 0.1,
+	"yandexgpt":            1.2,
+	"yandexgpt:async":      0.6,
+}
+
+// Cost estimates the cost of tokens, and reports false when the model has
+// no price.
+func (p Prices) Cost(model, mode string, tokens int) (float64, bool) {
+	name := ModelName(model)
+	price, ok := p[name+":"+mode]
+	if !ok {
+		price, ok = p[name]
+	}
+	if !ok {
+		return 0, false
+	}
+	return float64(tokens) / 1000 * price, true
+}
+
+// ModelName strips the folder of a gpt:// URI and the version from a model,
+// so that "gpt://b1g/yandexgpt/rc" becomes "yandexgpt". Other URIs, such as
+// ds:// for fine-tuned models, are kept as they are.
+func ModelName(model string) string {
+	if rest, ok := strings.CutPrefix(model, "gpt://"); ok {
+		_, model, _ = strings.Cut(rest, "/")
+	} else if strings.Contains(model, "://") {
+		return model
+	}
+	name, _, _ := strings.Cut(model, "/")
+	return name
+}
+
+// Record is one completion. Cost is nil when the model has no price.
+type Record struct {
+	Time         time.Time `json:"time"`
+	Backend      string    `json:"backend"`
+	Kind         string    `json:"kind"`
+	Model        string    `json:"model"`
+	Mode         string    `json:"mode"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         *float64  `json:"cost,omitempty"`
+	Status       string    `json:"status,omitempty"`
+}
+
+// Meter collects the usage of one run. It is an ai.UsageRecorder.
+type Meter struct {
+	backend string
+	prices  Prices
+	now     func() time.Time
+
+	mu      sync.Mutex
+	records []Record
+}
+
+func NewMeter(backend string, prices Prices) *Meter {
+	return &Meter{backend: backend, prices: prices, now: time.Now}
+}
+
+func (m *Meter) RecordUsage(u ai.Usage) {
+	m.record(m.backend, u)
+}
+
+// Backend returns a recorder that adds to the same records under another
+// backend, for runs that use several of them.
+func (m *Meter) Backend(name string) ai.UsageRecorder {
+	return backendRecorder{meter: m, backend: name}
+}
+
+type backendRecorder struct {
+	meter   *Meter
+	backend string
+}
+
+func (r backendRecorder) RecordUsage(u ai.Usage) {
+	r.meter.record(r.backend, u)
+}
+
+func (m *Meter) record(backend string, u ai.Usage) {
+	record := Record{
+		Time:         m.now(),
+		Backend:      backend,
+		Kind:         string(u.Kind),
+		Model:        ModelName(u.Model),
+		Mode:         u.Mode,
+		InputTokens:  u.InputTokens,
+		OutputTokens: u.OutputTokens,
+		Status:       u.Status,
+	}
+	if cost, ok := m.prices.Cost(u.Model, u.Mode, u.InputTokens+u.OutputTokens); ok {
+		record.Cost = &cost
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, record)
+}
+
+func (m *Meter) Records() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record(nil), m.records...)
+}
+
+// Summary adds up records. Unpriced counts the requests left out of Cost.
+type Summary struct {
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	Unpriced     int     `json:"unpriced,omitempty"`
+}
+
+func Summarize(records []Record) *Summary {
+	summary := &Summary{}
+	for _, record := range records {
+		summary.Add(record)
+	}
+	return summary
+}
+
+func (s *Summary) Add(record Record) {
+	s.Requests++
+	s.InputTokens += record.InputTokens
+	s.OutputTokens += record.OutputTokens
+	if record.Cost != nil {
+		s.Cost += *record.Cost
+	} else {
+		s.Unpriced++
+	}
+}
+
+func (s *Summary) String() string {
+	text := fmt.Sprintf("%d request(s), %d input and %d output tokens, estimated cost %.2f", s.Requests, s.InputTokens, s.OutputTokens, s.Cost)
+	if s.Unpriced > 0 {
+		text += fmt.Sprintf(" (%d request(s) without a price)", s.Unpriced)
+	}
+	return text
+}
@@ -0,0 +1,63 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deck/branchtale/internal/ai"
+)
+
+func TestModelName(t *testing.T) {
+	tests := map[string]string{
+		"yandexgpt-lite/latest":    "yandexgpt-lite",
+		"yandexgpt":                "yandexgpt",
+		"gpt://b1g/yandexgpt/rc":   "yandexgpt",
+		"ds://bt1abc":              "ds://bt1abc",
+		"gpt://b1g/yandexgpt-lite": "yandexgpt-lite",
+	}
+	for model, want := range tests {
+		if got := ModelName(model); got != want {
+			t.Errorf("ModelName(%q) = %q, expected %q", model, got, want)
+		}
+	}
+}
+
+func TestPrices_Cost(t *testing.T) {
+	if cost, ok := DefaultPrices.Cost("yandexgpt/latest", "sync", 2000); !ok || cost != 2.4 {
+		t.Errorf("Expected 2.4 for 2000 tokens, got %v", cost)
+	}
+	if cost, ok := DefaultPrices.Cost("yandexgpt/latest", "async", 2000); !ok || cost != 1.2 {
+		t.Errorf("Expected the async price, got %v", cost)
+	}
+	if cost, ok := DefaultPrices.Cost("yandexgpt-lite/latest", "stream", 1000); !ok || cost != 0.2 {
+		t.Errorf("Expected the model price for a mode without its own, got %v", cost)
+	}
+	if _, ok := DefaultPrices.Cost("ds://bt1abc", "sync", 1000); ok {
+		t.Error("Expected no price for a fine-tuned model")
+	}
+}
+
+func TestMeter(t *testing.T) {
+	meter := NewMeter("yandex", DefaultPrices)
+	meter.now = func() time.Time { return time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC) }
+	meter.RecordUsage(ai.Usage{Kind: ai.KindContent, Model: "yandexgpt-lite/latest", Mode: "sync", InputTokens: 900, OutputTokens: 100})
+	meter.RecordUsage(ai.Usage{Kind: ai.KindTitle, Model: "ds://bt1abc", Mode: "sync", InputTokens: 50, OutputTokens: 10})
+
+	records := meter.Records()
+	if len(records) != 2 || records[0].Model != "yandexgpt-lite" || records[0].Backend != "yandex" || records[0].Cost == nil || *records[0].Cost != 0.2 {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	summary := Summarize(records)
+	if summary.Requests != 2 || summary.InputTokens != 950 || summary.OutputTokens != 110 || summary.Cost != 0.2 || summary.Unpriced != 1 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if want := "2 request(s), 950 input and 110 output tokens, estimated cost 0.20 (1 request(s) without a price)"; summary.String() != want {
+		t.Errorf("Expected %q, got %q", want, summary.String())
+	}
+
+	meter.Backend("openai").RecordUsage(ai.Usage{Kind: ai.KindTitle, Model: "gpt-4o-mini", Mode: "sync", InputTokens: 50, OutputTokens: 10})
+	if records := meter.Records(); len(records) != 3 || records[2].Backend != "openai" {
+		t.Errorf("Expected the record under the other backend, got %+v", records)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/deck/branchtale/internal/httpclient"
 	"github.com/google/go-github/v74/github"
 	"golang.org/x/oauth2"
 )
@@ -14,6 +15,8 @@ import (
 type Provider interface {
 	CreatePullRequest(ctx context.Context, req *CreatePullRequestRequest) (*CreatePullRequestResponse, error)
 	MergePullRequest(ctx context.Context, req *MergePullRequestRequest) (*MergePullRequestResponse, error)
+	FindPullRequest(ctx context.Context, req *FindPullRequestRequest) (*PullRequest, error)
+	UpdatePullRequest(ctx context.Context, req *UpdatePullRequestRequest) error
 }
 
 type CreatePullRequestRequest struct {
@@ -43,6 +46,33 @@ type MergePullRequestResponse struct {
 	Message string
 }
 
+type FindPullRequestRequest struct {
+	Owner      string
+	Repo       string
+	HeadBranch string
+}
+
+type PullRequest struct {
+	Number      int
+	URL         string
+	Title       string
+	Description string
+	HeadBranch  string
+	BaseBranch  string
+	Open        bool
+	Merged      bool
+}
+
+// UpdatePullRequestRequest changes the description and/or the base branch
+// of a pull request. Empty fields are left unchanged.
+type UpdatePullRequestRequest struct {
+	Owner       string
+	Repo        string
+	Number      int
+	Description string
+	BaseBranch  string
+}
+
 type GitHubProvider struct {
 	client *github.Client
 }
@@ -51,7 +81,12 @@ func NewGitHubProvider(token string) *GitHubProvider {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(context.Background(), ts)
+	return NewGitHubProviderWithTokenSource(ts)
+}
+
+func NewGitHubProviderWithTokenSource(ts oauth2.TokenSource) *GitHubProvider {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpclient.New(httpclient.Options{}))
+	tc := oauth2.NewClient(ctx, ts)
 	client := github.NewClient(tc)
 
 	return &GitHubProvider{client: client}
@@ -105,6 +140,54 @@ func (g *GitHubProvider) MergePullRequest(ctx context.Context, req *MergePullReq
 	}, nil
 }
 
+// FindPullRequest returns the most recent pull request opened from the
+// branch, or nil if there is none.
+func (g *GitHubProvider) FindPullRequest(ctx context.Context, req *FindPullRequestRequest) (*PullRequest, error) {
+	options := &github.PullRequestListOptions{
+		Head:        req.Owner + ":" + req.HeadBranch,
+		State:       "all",
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+
+	pulls, _, err := g.client.PullRequests.List(ctx, req.Owner, req.Repo, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+
+	pr := pulls[0]
+	return &PullRequest{
+		Number:      pr.GetNumber(),
+		URL:         pr.GetHTMLURL(),
+		Title:       pr.GetTitle(),
+		Description: pr.GetBody(),
+		HeadBranch:  pr.GetHead().GetRef(),
+		BaseBranch:  pr.GetBase().GetRef(),
+		Open:        pr.GetState() == "open",
+		Merged:      pr.MergedAt != nil,
+	}, nil
+}
+
+func (g *GitHubProvider) UpdatePullRequest(ctx context.Context, req *UpdatePullRequestRequest) error {
+	update := &github.PullRequest{}
+	if req.Description != "" {
+		update.Body = &req.Description
+	}
+	if req.BaseBranch != "" {
+		update.Base = &github.PullRequestBranch{Ref: &req.BaseBranch}
+	}
+
+	_, _, err := g.client.PullRequests.Edit(ctx, req.Owner, req.Repo, req.Number, update)
+	if err != nil {
+		return fmt.Errorf("failed to update pull request: %w", err)
+	}
+	return nil
+}
+
 func ParseGitHubURL(remoteURL string) (owner, repo string, err error) {
 	sshRegex := regexp.MustCompile(`git@github\.com:(.+)/(.+)\.git`)
 	if matches := sshRegex.FindStringSubmatch(remoteURL); len(matches) == 3 {
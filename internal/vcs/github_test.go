@@ -1,7 +1,15 @@
 package vcs
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+
+	"github.com/google/go-github/v74/github"
 )
 
 func TestParseGitHubURL(t *testing.T) {
@@ -76,3 +84,66 @@ func TestParseGitHubURL(t *testing.T) {
 		})
 	}
 }
+
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *GitHubProvider {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return &GitHubProvider{client: client}
+}
+
+func TestGitHubProvider_FindPullRequest(t *testing.T) {
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/pulls" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if head := r.URL.Query().Get("head"); head != "owner:feature-a" {
+			t.Errorf("expected head filter owner:feature-a, got %s", head)
+		}
+		fmt.Fprint(w, `[{"number": 12, "html_url": "https://github.com/owner/repo/pull/12", "state": "closed",
+			"merged_at": "2025-01-01T00:00:00Z", "head": {"ref": "feature-a"}, "base": {"ref": "main"}}]`)
+	})
+
+	pr, err := provider.FindPullRequest(context.Background(), &FindPullRequestRequest{Owner: "owner", Repo: "repo", HeadBranch: "feature-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.Number != 12 || pr.Open || !pr.Merged || pr.BaseBranch != "main" {
+		t.Errorf("unexpected pull request: %+v", pr)
+	}
+}
+
+func TestGitHubProvider_FindPullRequest_none(t *testing.T) {
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	pr, err := provider.FindPullRequest(context.Background(), &FindPullRequestRequest{Owner: "owner", Repo: "repo", HeadBranch: "feature-a"})
+	if err != nil || pr != nil {
+		t.Errorf("expected no pull request, got %+v, %v", pr, err)
+	}
+}
+
+func TestGitHubProvider_UpdatePullRequest(t *testing.T) {
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/repos/owner/repo/pulls/13" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["base"] != "feature-a" {
+			t.Errorf("expected base feature-a, got %v", body["base"])
+		}
+		if _, ok := body["body"]; ok {
+			t.Errorf("expected body to be left unchanged")
+		}
+		fmt.Fprint(w, `{"number": 13}`)
+	})
+
+	err := provider.UpdatePullRequest(context.Background(), &UpdatePullRequestRequest{Owner: "owner", Repo: "repo", Number: 13, BaseBranch: "feature-a"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}